@@ -12,7 +12,7 @@ build() {
   local name="stackscope-agent-${goos}-${goarch}"
 
   echo "Building ${name}..."
-  GOOS="$goos" GOARCH="$goarch" go build -o "$OUT_DIR/$name" "$ROOT_DIR/main.go"
+  (cd "$ROOT_DIR" && GOOS="$goos" GOARCH="$goarch" go build -o "$OUT_DIR/$name" .)
 }
 
 build linux amd64
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type certificatesConfig struct {
+	// Files are globs of PEM files; the first certificate in a file is
+	// the leaf and the rest its chain, as in fullchain.pem.
+	Files     []string                    `json:"files"`
+	Endpoints []certificateEndpointConfig `json:"endpoints"`
+	// CAFiles are PEM files of private CAs trusted in addition to the
+	// system roots when verifying chains.
+	CAFiles  []string `json:"ca_files"`
+	Interval duration `json:"interval"`
+	Timeout  duration `json:"timeout"`
+	// A certificate expiring within WarnDays is a warning, within
+	// CriticalDays critical.
+	WarnDays     int `json:"warn_days"`
+	CriticalDays int `json:"critical_days"`
+}
+
+// certificateEndpointConfig is a TLS server to check. ServerName is sent
+// as SNI and verified against the certificate; it defaults to the host of
+// Address.
+type certificateEndpointConfig struct {
+	Address    string `json:"address"`
+	ServerName string `json:"server_name"`
+}
+
+type certificateInfo struct {
+	Source     string   `json:"source"`
+	Target     string   `json:"target"`
+	Subject    string   `json:"subject,omitempty"`
+	SANs       []string `json:"sans,omitempty"`
+	Issuer     string   `json:"issuer,omitempty"`
+	NotBefore  string   `json:"not_before,omitempty"`
+	NotAfter   string   `json:"not_after,omitempty"`
+	DaysLeft   int      `json:"days_left"`
+	ChainValid bool     `json:"chain_valid"`
+	ChainError string   `json:"chain_error,omitempty"`
+	CheckedAt  string   `json:"checked_at"`
+	Error      string   `json:"error,omitempty"`
+	notAfter   time.Time
+}
+
+func (c certificatesConfig) validate() error {
+	for _, pattern := range c.Files {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern %q", pattern)
+		}
+	}
+	for i, endpoint := range c.Endpoints {
+		if _, _, err := net.SplitHostPort(endpoint.Address); err != nil {
+			return fmt.Errorf("endpoints[%d]: address must be host:port", i)
+		}
+	}
+	if c.Interval.Duration <= 0 || c.Timeout.Duration <= 0 {
+		return fmt.Errorf("interval and timeout must be positive")
+	}
+	if c.CriticalDays < 0 || c.WarnDays < c.CriticalDays {
+		return fmt.Errorf("warn_days must be at least critical_days")
+	}
+	return nil
+}
+
+// certificateCache holds the last check. Endpoints need a TLS handshake, so
+// checks run in the background at most once per interval; days_left is
+// recomputed on every read.
+type certificateCache struct {
+	mu        sync.Mutex
+	certs     []certificateInfo
+	refreshed time.Time
+	running   bool
+}
+
+var certificates = &certificateCache{}
+
+func readCertificates(now time.Time) []certificateInfo {
+	if len(cfg.Certificates.Files) == 0 && len(cfg.Certificates.Endpoints) == 0 {
+		return nil
+	}
+	certificates.mu.Lock()
+	defer certificates.mu.Unlock()
+	if !certificates.running && now.Sub(certificates.refreshed) >= cfg.Certificates.Interval.Duration {
+		certificates.running = true
+		go certificates.refresh()
+	}
+	result := append([]certificateInfo(nil), certificates.certs...)
+	for i := range result {
+		if !result[i].notAfter.IsZero() {
+			result[i].DaysLeft = daysUntil(result[i].notAfter, now)
+		}
+	}
+	return result
+}
+
+func (c *certificateCache) refresh() {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	for _, path := range cfg.Certificates.CAFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("load CA file failed: %v", err)
+			continue
+		}
+		if !roots.AppendCertsFromPEM(data) {
+			log.Printf("load CA file %s failed: no certificates", path)
+		}
+	}
+
+	var certs []certificateInfo
+	var paths []string
+	for _, pattern := range cfg.Certificates.Files {
+		matches, _ := filepath.Glob(pattern)
+		// A pattern matching nothing usually means a renewal moved or
+		// deleted the files; report it rather than go quiet.
+		if len(matches) == 0 {
+			certs = append(certs, certificateInfo{
+				Source:    "file",
+				Target:    pattern,
+				CheckedAt: time.Now().UTC().Format(time.RFC3339),
+				Error:     "no files match",
+			})
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		certs = append(certs, readCertificateFile(path, roots))
+	}
+	for _, endpoint := range cfg.Certificates.Endpoints {
+		certs = append(certs, readCertificateEndpoint(endpoint, roots))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.certs = certs
+	c.refreshed = time.Now()
+	c.running = false
+}
+
+func readCertificateFile(path string, roots *x509.CertPool) certificateInfo {
+	info := certificateInfo{Source: "file", Target: path, CheckedAt: time.Now().UTC().Format(time.RFC3339)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			info.Error = err.Error()
+			return info
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		info.Error = "no certificate found"
+		return info
+	}
+	describeCertificate(&info, chain, "", roots)
+	return info
+}
+
+func readCertificateEndpoint(endpoint certificateEndpointConfig, roots *x509.CertPool) certificateInfo {
+	info := certificateInfo{Source: "endpoint", Target: endpoint.Address, CheckedAt: time.Now().UTC().Format(time.RFC3339)}
+	serverName := endpoint.ServerName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(endpoint.Address)
+	}
+	// Verification is done separately so an invalid chain is still
+	// reported with its expiry.
+	dialer := &net.Dialer{Timeout: cfg.Certificates.Timeout.Duration}
+	conn, err := tls.DialWithDialer(dialer, "tcp", endpoint.Address, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	chain := conn.ConnectionState().PeerCertificates
+	conn.Close()
+	if len(chain) == 0 {
+		info.Error = "no certificate presented"
+		return info
+	}
+	describeCertificate(&info, chain, serverName, roots)
+	return info
+}
+
+// describeCertificate fills info from the leaf and verifies the chain
+// against roots, and against dnsName when it is set.
+func describeCertificate(info *certificateInfo, chain []*x509.Certificate, dnsName string, roots *x509.CertPool) {
+	leaf := chain[0]
+	info.Subject = leaf.Subject.String()
+	info.Issuer = leaf.Issuer.String()
+	info.SANs = append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	info.NotBefore = leaf.NotBefore.UTC().Format(time.RFC3339)
+	info.NotAfter = leaf.NotAfter.UTC().Format(time.RFC3339)
+	info.notAfter = leaf.NotAfter
+	info.DaysLeft = daysUntil(leaf.NotAfter, time.Now())
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       dnsName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	info.ChainValid = err == nil
+	if err != nil {
+		info.ChainError = err.Error()
+	}
+}
+
+// daysUntil returns whole days left, negative once expired.
+func daysUntil(t, now time.Time) int {
+	left := t.Sub(now)
+	days := int(left / (24 * time.Hour))
+	if left < 0 && left%(24*time.Hour) != 0 {
+		days--
+	}
+	return days
+}
+
+func evaluateCertificatesHealth(health *healthInfo, certs []certificateInfo) {
+	for _, c := range certs {
+		switch {
+		case c.Error != "":
+			health.degrade("warning", fmt.Sprintf("certificate %s unreadable: %s", c.Target, c.Error))
+			continue
+		case c.DaysLeft < 0:
+			health.degrade("critical", fmt.Sprintf("certificate %s expired", c.Target))
+		case c.DaysLeft <= cfg.Certificates.CriticalDays:
+			health.degrade("critical", fmt.Sprintf("certificate %s expires in %dd", c.Target, c.DaysLeft))
+		case c.DaysLeft <= cfg.Certificates.WarnDays:
+			health.degrade("warning", fmt.Sprintf("certificate %s expires in %dd", c.Target, c.DaysLeft))
+		}
+		if !c.ChainValid && c.DaysLeft >= 0 {
+			health.degrade("warning", fmt.Sprintf("certificate %s chain invalid: %s", c.Target, c.ChainError))
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func (c testCert) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+}
+
+// newTestCert creates a certificate signed by parent, or self-signed when
+// parent is nil.
+func newTestCert(t *testing.T, name string, notAfter time.Time, isCA bool, parent *testCert) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{name}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{cert: cert, der: der, key: key}
+}
+
+type testPKI struct {
+	ca, expiring, selfSigned testCert
+	roots                    *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	var p testPKI
+	p.ca = newTestCert(t, "Test CA", time.Now().Add(365*24*time.Hour), true, nil)
+	// Half a day of slack keeps days_left stable while the test runs.
+	p.expiring = newTestCert(t, "expiring.test", time.Now().Add(5*24*time.Hour+12*time.Hour), false, &p.ca)
+	p.selfSigned = newTestCert(t, "self.test", time.Now().Add(60*24*time.Hour+12*time.Hour), false, nil)
+	p.roots = x509.NewCertPool()
+	p.roots.AddCert(p.ca.cert)
+	return p
+}
+
+func writeTestFile(t *testing.T, path string, data ...[]byte) {
+	t.Helper()
+	var content []byte
+	for _, d := range data {
+		content = append(content, d...)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func useCertificatesConfig(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+}
+
+func TestReadCertificateFile(t *testing.T) {
+	useCertificatesConfig(t)
+	pki := newTestPKI(t)
+	dir := t.TempDir()
+
+	fullchain := filepath.Join(dir, "fullchain.pem")
+	key, _ := x509.MarshalECPrivateKey(pki.expiring.key)
+	writeTestFile(t, fullchain, pki.expiring.pem(), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), pki.ca.pem())
+	info := readCertificateFile(fullchain, pki.roots)
+	if info.Error != "" || !info.ChainValid {
+		t.Fatalf("fullchain = %+v", info)
+	}
+	if info.Source != "file" || info.Target != fullchain || info.Subject != "CN=expiring.test" || info.Issuer != "CN=Test CA" {
+		t.Errorf("fullchain = %+v", info)
+	}
+	if strings.Join(info.SANs, ",") != "expiring.test,127.0.0.1" {
+		t.Errorf("sans = %q", info.SANs)
+	}
+	if info.DaysLeft != 5 {
+		t.Errorf("days_left = %d, want 5", info.DaysLeft)
+	}
+
+	selfSigned := filepath.Join(dir, "self.pem")
+	writeTestFile(t, selfSigned, pki.selfSigned.pem())
+	info = readCertificateFile(selfSigned, pki.roots)
+	if info.Error != "" || info.ChainValid || info.ChainError == "" || info.DaysLeft != 60 {
+		t.Errorf("self-signed = %+v, want an invalid chain with 60 days left", info)
+	}
+
+	empty := filepath.Join(dir, "key-only.pem")
+	writeTestFile(t, empty, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}))
+	if info := readCertificateFile(empty, pki.roots); info.Error != "no certificate found" {
+		t.Errorf("key only = %+v", info)
+	}
+	if info := readCertificateFile(filepath.Join(dir, "missing.pem"), pki.roots); info.Error == "" {
+		t.Errorf("missing file = %+v", info)
+	}
+}
+
+func TestReadCertificateEndpoint(t *testing.T) {
+	useCertificatesConfig(t)
+	pki := newTestPKI(t)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{pki.expiring.der, pki.ca.der},
+			PrivateKey:  pki.expiring.key,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	address := listener.Addr().String()
+
+	info := readCertificateEndpoint(certificateEndpointConfig{Address: address}, pki.roots)
+	if info.Error != "" || !info.ChainValid || info.Source != "endpoint" || info.Target != address {
+		t.Fatalf("endpoint = %+v", info)
+	}
+	if info.Subject != "CN=expiring.test" || info.DaysLeft != 5 {
+		t.Errorf("endpoint = %+v", info)
+	}
+
+	// A name the certificate does not cover still reports the expiry.
+	info = readCertificateEndpoint(certificateEndpointConfig{Address: address, ServerName: "other.test"}, pki.roots)
+	if info.Error != "" || info.ChainValid || info.ChainError == "" || info.DaysLeft != 5 {
+		t.Errorf("wrong server name = %+v", info)
+	}
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddress := closed.Addr().String()
+	closed.Close()
+	if info := readCertificateEndpoint(certificateEndpointConfig{Address: closedAddress}, pki.roots); info.Error == "" {
+		t.Errorf("closed port = %+v", info)
+	}
+}
+
+func TestCertificateRefresh(t *testing.T) {
+	useCertificatesConfig(t)
+	pki := newTestPKI(t)
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.pem"), pki.expiring.pem())
+	writeTestFile(t, filepath.Join(dir, "ca.crt"), pki.ca.pem())
+
+	missing := filepath.Join(dir, "renewed", "*.pem")
+	cfg.Certificates.Files = []string{filepath.Join(dir, "*.pem"), missing}
+	cfg.Certificates.CAFiles = []string{filepath.Join(dir, "ca.crt")}
+
+	cache := &certificateCache{running: true}
+	cache.refresh()
+	if cache.running || cache.refreshed.IsZero() {
+		t.Errorf("refresh left running=%v refreshed=%v", cache.running, cache.refreshed)
+	}
+	if len(cache.certs) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(cache.certs), cache.certs)
+	}
+	if c := cache.certs[0]; c.Target != missing || c.Source != "file" || c.Error != "no files match" || c.CheckedAt == "" {
+		t.Errorf("unmatched glob = %+v", c)
+	}
+	if c := cache.certs[1]; c.Target != filepath.Join(dir, "a.pem") || !c.ChainValid {
+		t.Errorf("a.pem = %+v, want a valid chain through ca_files", c)
+	}
+}
+
+func TestDaysUntil(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		left time.Duration
+		want int
+	}{
+		{48 * time.Hour, 2},
+		{47 * time.Hour, 1},
+		{time.Hour, 0},
+		{0, 0},
+		{-time.Hour, -1},
+		{-24 * time.Hour, -1},
+		{-25 * time.Hour, -2},
+	}
+	for _, tt := range tests {
+		if got := daysUntil(now.Add(tt.left), now); got != tt.want {
+			t.Errorf("daysUntil(now%+v) = %d, want %d", tt.left, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateCertificatesHealth(t *testing.T) {
+	useCertificatesConfig(t)
+	tests := []struct {
+		name   string
+		cert   certificateInfo
+		status string
+		reason string
+	}{
+		{"fresh", certificateInfo{Target: "a", DaysLeft: 90, ChainValid: true}, "ok", ""},
+		{"just outside warn_days", certificateInfo{Target: "a", DaysLeft: 22, ChainValid: true}, "ok", ""},
+		{"at warn_days", certificateInfo{Target: "a", DaysLeft: 21, ChainValid: true}, "warning", "certificate a expires in 21d"},
+		{"just outside critical_days", certificateInfo{Target: "a", DaysLeft: 8, ChainValid: true}, "warning", "certificate a expires in 8d"},
+		{"at critical_days", certificateInfo{Target: "a", DaysLeft: 7, ChainValid: true}, "critical", "certificate a expires in 7d"},
+		{"expires today", certificateInfo{Target: "a", DaysLeft: 0, ChainValid: true}, "critical", "certificate a expires in 0d"},
+		{"expired", certificateInfo{Target: "a", DaysLeft: -1}, "critical", "certificate a expired"},
+		{"invalid chain", certificateInfo{Target: "a", DaysLeft: 90, ChainError: "x509: unknown authority"}, "warning", "certificate a chain invalid: x509: unknown authority"},
+		{"unmatched glob", certificateInfo{Target: "/etc/ssl/*.pem", Error: "no files match"}, "warning", "certificate /etc/ssl/*.pem unreadable: no files match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := healthInfo{Status: "ok"}
+			evaluateCertificatesHealth(&health, []certificateInfo{tt.cert})
+			if health.Status != tt.status || strings.Join(health.Reasons, "; ") != tt.reason {
+				t.Errorf("health = %s %q, want %s %q", health.Status, health.Reasons, tt.status, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// readCgroupValue reads a single-value cgroup v2 file. ok is false when the
+// file is missing or holds "max".
+func readCgroupValue(dir, name string) (uint64, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, false
+	}
+	val, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return val, true
+}
+
+// readCgroupKeyed parses flat keyed files such as cpu.stat, memory.stat and
+// memory.events.
+func readCgroupKeyed(dir, name string) map[string]uint64 {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil
+	}
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[fields[0]] = val
+	}
+	return values
+}
+
+// readCgroupIO sums read and written bytes across all devices in io.stat.
+func readCgroupIO(dir string) (uint64, uint64) {
+	data, err := os.ReadFile(filepath.Join(dir, "io.stat"))
+	if err != nil {
+		return 0, 0
+	}
+	var readBytes, writeBytes uint64
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			val, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "rbytes":
+				readBytes += val
+			case "wbytes":
+				writeBytes += val
+			}
+		}
+	}
+	return readBytes, writeBytes
+}
+
+// readCgroupMemoryUsed returns memory.current minus reclaimable page cache,
+// the same figure `docker stats` reports.
+func readCgroupMemoryUsed(dir string) uint64 {
+	current, ok := readCgroupValue(dir, "memory.current")
+	if !ok {
+		return 0
+	}
+	inactive := readCgroupKeyed(dir, "memory.stat")["inactive_file"]
+	if inactive < current {
+		return current - inactive
+	}
+	return current
+}
+
+// readProcCgroup returns the cgroup v2 directory of a process.
+func readProcCgroup(pid string) (string, error) {
+	data, err := os.ReadFile("/proc/" + pid + "/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(cgroupRoot, path), nil
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+type pressureInfo struct {
+	CPU    psiInfo `json:"cpu"`
+	Memory psiInfo `json:"memory"`
+	IO     psiInfo `json:"io"`
+}
+
+type psiInfo struct {
+	SomeAvg10 float64 `json:"some_avg10"`
+	SomeAvg60 float64 `json:"some_avg60"`
+	FullAvg10 float64 `json:"full_avg10,omitempty"`
+	FullAvg60 float64 `json:"full_avg60,omitempty"`
+}
+
+// readCgroupPressure parses cpu.pressure, memory.pressure and io.pressure.
+// It returns nil when PSI is not enabled in the kernel.
+func readCgroupPressure(dir string) *pressureInfo {
+	cpu, okCPU := readPSIFile(filepath.Join(dir, "cpu.pressure"))
+	memory, okMemory := readPSIFile(filepath.Join(dir, "memory.pressure"))
+	io, okIO := readPSIFile(filepath.Join(dir, "io.pressure"))
+	if !okCPU && !okMemory && !okIO {
+		return nil
+	}
+	return &pressureInfo{CPU: cpu, Memory: memory, IO: io}
+}
+
+func readPSIFile(path string) (psiInfo, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return psiInfo{}, false
+	}
+	var info psiInfo
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		var avg10, avg60 float64
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "avg10":
+				avg10, _ = strconv.ParseFloat(value, 64)
+			case "avg60":
+				avg60, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			info.SomeAvg10, info.SomeAvg60 = avg10, avg60
+		case "full":
+			info.FullAvg10, info.FullAvg60 = avg10, avg60
+		}
+	}
+	return info, true
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+type agentConfig struct {
+	StateDir     string             `json:"state_dir"`
+	Filesystems  filesystemsConfig  `json:"filesystems"`
+	Events       eventsConfig       `json:"events"`
+	Network      networkConfig      `json:"network"`
+	Traffic      trafficConfig      `json:"traffic"`
+	Sockets      socketsConfig      `json:"sockets"`
+	Ports        portsConfig        `json:"ports"`
+	Limits       limitsConfig       `json:"limits"`
+	Wireguard    wireguardConfig    `json:"wireguard"`
+	Probes       probesConfig       `json:"probes"`
+	Certificates certificatesConfig `json:"certificates"`
+	Maintenance  maintenanceConfig  `json:"maintenance"`
+	Containers   containersConfig   `json:"containers"`
+	Services     servicesConfig     `json:"services"`
+	Systemd      systemdConfig      `json:"systemd"`
+	Processes    processesConfig    `json:"processes"`
+	Sensors      sensorsConfig      `json:"sensors"`
+	Throttling   throttlingConfig   `json:"throttling"`
+	Smart        smartConfig        `json:"smart"`
+	Storage      storageConfig      `json:"storage"`
+}
+
+var cfg = defaultConfig()
+
+func defaultConfig() agentConfig {
+	return agentConfig{
+		StateDir: "/var/lib/stackscope-agent",
+		Filesystems: filesystemsConfig{
+			StatfsTimeout: duration{2 * time.Second},
+			Exclude: filesystemFilter{
+				FSTypes: defaultExcludedFSTypes,
+			},
+			DedupeBinds:  true,
+			FSUsageLimit: 3,
+			Forecast: forecastConfig{
+				Enabled:        true,
+				SampleInterval: duration{10 * time.Minute},
+				Window:         duration{72 * time.Hour},
+				WarnWithin:     duration{48 * time.Hour},
+				CriticalWithin: duration{6 * time.Hour},
+			},
+		},
+		Events: eventsConfig{
+			Retention:    duration{24 * time.Hour},
+			HealthWindow: duration{time.Hour},
+		},
+		Network: networkConfig{
+			Exclude: []string{"lo"},
+		},
+		Traffic: trafficConfig{
+			Enabled:        true,
+			SampleInterval: duration{5 * time.Minute},
+			BillingDay:     1,
+		},
+		Sockets: socketsConfig{
+			Enabled: true,
+		},
+		Ports: portsConfig{
+			Enabled: true,
+		},
+		Limits: limitsConfig{
+			Enabled:         true,
+			WarnPercent:     80,
+			CriticalPercent: 95,
+		},
+		Wireguard: wireguardConfig{
+			Enabled:         true,
+			HandshakeMaxAge: duration{5 * time.Minute},
+		},
+		Probes: probesConfig{
+			History: 60,
+		},
+		Certificates: certificatesConfig{
+			Interval:     duration{time.Hour},
+			Timeout:      duration{5 * time.Second},
+			WarnDays:     21,
+			CriticalDays: 7,
+		},
+		Containers: containersConfig{
+			Enabled:      true,
+			DockerSocket: "/var/run/docker.sock",
+			PodmanSockets: []string{
+				"/run/podman/podman.sock",
+				"/run/user/*/podman/podman.sock",
+			},
+			ContainerdStateDirs: []string{
+				"/run/containerd/io.containerd.runtime.v2.task",
+				"/run/k3s/containerd/io.containerd.runtime.v2.task",
+			},
+		},
+		Services: servicesConfig{
+			Enabled: true,
+		},
+		Systemd: systemdConfig{
+			Enabled: true,
+		},
+		Processes: processesConfig{
+			TopN:   10,
+			SortBy: []string{"cpu", "memory", "io"},
+			RedactPatterns: []string{
+				`(?i)(?:password|passwd|secret|token|api[-_]?key)[=:\s]+(\S+)`,
+			},
+		},
+		Sensors: sensorsConfig{
+			Enabled:    true,
+			CritMargin: 5,
+		},
+		Throttling: throttlingConfig{
+			Enabled: true,
+		},
+		Smart: smartConfig{
+			Enabled:  true,
+			Smartctl: "smartctl",
+			Interval: duration{30 * time.Minute},
+		},
+		Storage: storageConfig{
+			Enabled: true,
+			Zpool:   "zpool",
+		},
+	}
+}
+
+func loadConfig(path string) (agentConfig, error) {
+	conf := defaultConfig()
+	if path == "" {
+		return conf, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return conf, err
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return conf, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := conf.validate(); err != nil {
+		return conf, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return conf, nil
+}
+
+func (c agentConfig) validate() error {
+	if err := c.Filesystems.validate(); err != nil {
+		return fmt.Errorf("filesystems: %w", err)
+	}
+	for i, window := range c.Maintenance.Windows {
+		if err := window.validate(); err != nil {
+			return fmt.Errorf("maintenance.windows[%d]: %w", i, err)
+		}
+	}
+	if err := c.Network.validate(); err != nil {
+		return fmt.Errorf("network: %w", err)
+	}
+	if err := c.Traffic.validate(); err != nil {
+		return fmt.Errorf("traffic: %w", err)
+	}
+	if err := c.Limits.validate(); err != nil {
+		return fmt.Errorf("limits: %w", err)
+	}
+	if err := c.Wireguard.validate(); err != nil {
+		return fmt.Errorf("wireguard: %w", err)
+	}
+	if err := c.Probes.validate(); err != nil {
+		return fmt.Errorf("probes: %w", err)
+	}
+	if err := c.Certificates.validate(); err != nil {
+		return fmt.Errorf("certificates: %w", err)
+	}
+	if err := c.Processes.validate(); err != nil {
+		return fmt.Errorf("processes: %w", err)
+	}
+	return nil
+}
+
+// duration accepts Go duration strings ("90s", "2h") or plain seconds in JSON.
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+	case string:
+		parsed, err := parseDuration(v)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+	case nil:
+		d.Duration = 0
+	default:
+		return fmt.Errorf("invalid duration %s", string(data))
+	}
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
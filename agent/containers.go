@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type containersConfig struct {
+	Enabled             bool     `json:"enabled"`
+	DockerSocket        string   `json:"docker_socket"`
+	PodmanSockets       []string `json:"podman_sockets"`
+	ContainerdStateDirs []string `json:"containerd_state_dirs"`
+}
+
+type containerInfo struct {
+	ID              string  `json:"id"`
+	Runtime         string  `json:"runtime"`
+	Name            string  `json:"name,omitempty"`
+	Owner           string  `json:"owner,omitempty"`
+	Namespace       string  `json:"namespace,omitempty"`
+	Pod             string  `json:"pod,omitempty"`
+	Image           string  `json:"image,omitempty"`
+	State           string  `json:"state,omitempty"`
+	Health          string  `json:"health,omitempty"`
+	RestartCount    int     `json:"restart_count,omitempty"`
+	UptimeSeconds   int64   `json:"uptime_seconds,omitempty"`
+	ComposeProject  string  `json:"compose_project,omitempty"`
+	ComposeService  string  `json:"compose_service,omitempty"`
+	CPUPercent      float64 `json:"cpu_percent,omitempty"`
+	MemoryUsedMB    float64 `json:"memory_used_mb,omitempty"`
+	MemoryLimitMB   float64 `json:"memory_limit_mb,omitempty"`
+	MemoryPercent   float64 `json:"memory_percent,omitempty"`
+	NetRxBytes      uint64  `json:"net_rx_bytes,omitempty"`
+	NetTxBytes      uint64  `json:"net_tx_bytes,omitempty"`
+	BlockReadBytes  uint64  `json:"block_read_bytes,omitempty"`
+	BlockWriteBytes uint64  `json:"block_write_bytes,omitempty"`
+	PIDs            uint64  `json:"pids,omitempty"`
+}
+
+type dockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+}
+
+type dockerInspect struct {
+	RestartCount int `json:"RestartCount"`
+	State        struct {
+		Status    string `json:"Status"`
+		StartedAt string `json:"StartedAt"`
+		Health    *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+type dockerCPUStats struct {
+	CPUUsage struct {
+		TotalUsage uint64 `json:"total_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  int    `json:"online_cpus"`
+}
+
+type dockerStats struct {
+	CPUStats    dockerCPUStats `json:"cpu_stats"`
+	PreCPUStats dockerCPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+const containerStatsWorkers = 8
+
+// readContainers merges containers from every runtime found on the host into
+// one list. A failing runtime does not hide the others.
+func readContainers() ([]containerInfo, error) {
+	if !cfg.Containers.Enabled {
+		return nil, nil
+	}
+
+	var result []containerInfo
+	var errs []error
+	// Podman's Docker-compatible socket is often symlinked at
+	// /var/run/docker.sock. Each socket is queried once, through the libpod
+	// API when it is also configured as a Podman socket.
+	queried := map[string]bool{}
+	for _, socket := range expandGlobs(cfg.Containers.PodmanSockets) {
+		resolved := resolveSocket(socket)
+		if queried[resolved] {
+			continue
+		}
+		queried[resolved] = true
+		containers, err := readPodmanContainers(socket)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("podman %s: %w", socket, err))
+		}
+		result = append(result, containers...)
+	}
+	if _, err := os.Stat(cfg.Containers.DockerSocket); err == nil && !queried[resolveSocket(cfg.Containers.DockerSocket)] {
+		containers, err := readDockerContainers(cfg.Containers.DockerSocket)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("docker: %w", err))
+		}
+		result = append(result, containers...)
+	}
+	for _, dir := range cfg.Containers.ContainerdStateDirs {
+		containers, err := readContainerdContainers(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("containerd %s: %w", dir, err))
+		}
+		result = append(result, containers...)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Runtime != result[j].Runtime {
+			return result[i].Runtime < result[j].Runtime
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, errors.Join(errs...)
+}
+
+func expandGlobs(patterns []string) []string {
+	var result []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		result = append(result, matches...)
+	}
+	return result
+}
+
+// resolveSocket follows symlinks so that one socket reached through
+// several paths is recognised.
+func resolveSocket(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// newUnixHTTPClient returns a client that sends every request to the given
+// unix socket regardless of the URL host.
+func newUnixHTTPClient(socket string, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+func getJSON(client *http.Client, rawURL string, v interface{}) error {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func readDockerContainers(socket string) ([]containerInfo, error) {
+	client := newUnixHTTPClient(socket, 5*time.Second)
+	defer client.CloseIdleConnections()
+
+	var list []dockerContainer
+	if err := getJSON(client, "http://docker/containers/json?all=1", &list); err != nil {
+		return nil, err
+	}
+
+	result := make([]containerInfo, len(list))
+	sem := make(chan struct{}, containerStatsWorkers)
+	var wg sync.WaitGroup
+	for i, c := range list {
+		wg.Add(1)
+		go func(i int, c dockerContainer) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result[i] = readDockerContainer(client, c)
+		}(i, c)
+	}
+	wg.Wait()
+	return result, nil
+}
+
+func readDockerContainer(client *http.Client, c dockerContainer) containerInfo {
+	info := containerInfo{
+		ID:             shortContainerID(c.ID),
+		Runtime:        "docker",
+		Image:          c.Image,
+		State:          c.State,
+		ComposeProject: c.Labels["com.docker.compose.project"],
+		ComposeService: c.Labels["com.docker.compose.service"],
+	}
+	if len(c.Names) > 0 {
+		info.Name = strings.TrimPrefix(c.Names[0], "/")
+	}
+
+	id := url.PathEscape(c.ID)
+	var inspect dockerInspect
+	if err := getJSON(client, "http://docker/containers/"+id+"/json", &inspect); err == nil {
+		info.RestartCount = inspect.RestartCount
+		if inspect.State.Health != nil {
+			info.Health = inspect.State.Health.Status
+		}
+		if inspect.State.Status == "running" {
+			info.UptimeSeconds = uptimeSince(inspect.State.StartedAt)
+		}
+	}
+
+	if c.State != "running" {
+		return info
+	}
+	var stats dockerStats
+	if err := getJSON(client, "http://docker/containers/"+id+"/stats?stream=false", &stats); err != nil {
+		return info
+	}
+	applyDockerStats(&info, stats)
+	return info
+}
+
+func applyDockerStats(info *containerInfo, stats dockerStats) {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	cpus := stats.CPUStats.OnlineCPUs
+	if cpus == 0 {
+		cpus = 1
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		info.CPUPercent = cpuDelta / systemDelta * float64(cpus) * 100
+	}
+
+	// Match `docker stats`: page cache that can be reclaimed is not usage.
+	used := stats.MemoryStats.Usage
+	cache := stats.MemoryStats.Stats["inactive_file"]
+	if cache == 0 {
+		cache = stats.MemoryStats.Stats["total_inactive_file"]
+	}
+	if cache < used {
+		used -= cache
+	}
+	info.MemoryUsedMB = float64(used) / (1024.0 * 1024.0)
+	info.MemoryLimitMB = float64(stats.MemoryStats.Limit) / (1024.0 * 1024.0)
+	info.MemoryPercent = percent(float64(used), float64(stats.MemoryStats.Limit))
+
+	for _, n := range stats.Networks {
+		info.NetRxBytes += n.RxBytes
+		info.NetTxBytes += n.TxBytes
+	}
+	for _, entry := range stats.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			info.BlockReadBytes += entry.Value
+		case "write":
+			info.BlockWriteBytes += entry.Value
+		}
+	}
+	info.PIDs = stats.PidsStats.Current
+}
+
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func uptimeSince(startedAt string) int64 {
+	started, err := time.Parse(time.RFC3339Nano, startedAt)
+	if err != nil || started.IsZero() {
+		return 0
+	}
+	uptime := int64(time.Since(started).Seconds())
+	if uptime < 0 {
+		return 0
+	}
+	return uptime
+}
+
+func evaluateContainersHealth(health *healthInfo, containers []containerInfo) {
+	for _, c := range containers {
+		name := c.Name
+		if name == "" {
+			name = c.ID
+		}
+		if c.Health == "unhealthy" {
+			health.degrade("warning", fmt.Sprintf("container '%s' unhealthy", name))
+		}
+		if c.State == "restarting" {
+			health.degrade("warning", fmt.Sprintf("container '%s' restarting", name))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ociSpec is the subset of the OCI runtime config.json containerd writes
+// into each task's state directory.
+type ociSpec struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+var containerdRates = newRateTracker()
+
+// readContainerdContainers lists containerd (and k3s) tasks from the shim
+// state directory <stateDir>/<namespace>/<id>, then reads usage from the
+// cgroup v2 hierarchy of each task's init process.
+func readContainerdContainers(stateDir string) ([]containerInfo, error) {
+	namespaces, err := os.ReadDir(stateDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	var result []containerInfo
+	for _, ns := range namespaces {
+		// Docker runs its containers in the "moby" namespace; they are already
+		// reported through the Engine API.
+		if !ns.IsDir() || ns.Name() == "moby" {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(stateDir, ns.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			info, ok := readContainerdContainer(filepath.Join(stateDir, ns.Name(), entry.Name()), ns.Name(), now)
+			if ok {
+				result = append(result, info)
+			}
+		}
+	}
+	return result, nil
+}
+
+func readContainerdContainer(dir, namespace string, now time.Time) (containerInfo, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return containerInfo{}, false
+	}
+	var spec ociSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return containerInfo{}, false
+	}
+	annotations := spec.Annotations
+	// Pod sandboxes (pause containers) are an implementation detail of CRI.
+	if annotations["io.kubernetes.cri.container-type"] == "sandbox" {
+		return containerInfo{}, false
+	}
+
+	id := filepath.Base(dir)
+	info := containerInfo{
+		ID:        shortContainerID(id),
+		Runtime:   "containerd",
+		Name:      firstNonEmpty(annotations["io.kubernetes.cri.container-name"], shortContainerID(id)),
+		Namespace: firstNonEmpty(annotations["io.kubernetes.cri.sandbox-namespace"], namespace),
+		Pod:       annotations["io.kubernetes.cri.sandbox-name"],
+		Image:     annotations["io.kubernetes.cri.image-name"],
+		State:     "stopped",
+	}
+
+	pidData, err := os.ReadFile(filepath.Join(dir, "init.pid"))
+	if err != nil {
+		return info, true
+	}
+	pid := strings.TrimSpace(string(pidData))
+	if _, err := os.Stat("/proc/" + pid); pid == "" || err != nil {
+		return info, true
+	}
+	info.State = "running"
+
+	if started, err := readProcessStartTime(pid); err == nil {
+		info.UptimeSeconds = int64(now.Sub(started).Seconds())
+	}
+	if cgroup, err := readProcCgroup(pid); err == nil {
+		applyCgroupStats(&info, cgroup, now)
+	}
+	// The init process lives in the container's network namespace.
+	if netStats, err := readNetSnapshotFile("/proc/" + pid + "/net/dev"); err == nil {
+		for name, stats := range netStats {
+			if name == "lo" {
+				continue
+			}
+			info.NetRxBytes += stats.RxBytes
+			info.NetTxBytes += stats.TxBytes
+		}
+	}
+	return info, true
+}
+
+func applyCgroupStats(info *containerInfo, dir string, now time.Time) {
+	usage := readCgroupKeyed(dir, "cpu.stat")["usage_usec"]
+	if rate, ok := containerdRates.rate(dir, usage, now); ok {
+		info.CPUPercent = rate / 1e6 * 100
+	}
+
+	used := readCgroupMemoryUsed(dir)
+	info.MemoryUsedMB = float64(used) / (1024.0 * 1024.0)
+	if limit, ok := readCgroupValue(dir, "memory.max"); ok {
+		info.MemoryLimitMB = float64(limit) / (1024.0 * 1024.0)
+		info.MemoryPercent = percent(float64(used), float64(limit))
+	}
+	info.BlockReadBytes, info.BlockWriteBytes = readCgroupIO(dir)
+	info.PIDs, _ = readCgroupValue(dir, "pids.current")
+}
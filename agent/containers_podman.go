@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/url"
+	"os/user"
+	"strings"
+	"time"
+)
+
+type podmanContainer struct {
+	ID        string            `json:"Id"`
+	Names     []string          `json:"Names"`
+	Image     string            `json:"Image"`
+	State     string            `json:"State"`
+	Labels    map[string]string `json:"Labels"`
+	StartedAt int64             `json:"StartedAt"`
+	PodName   string            `json:"PodName"`
+}
+
+type podmanHealth struct {
+	Status string `json:"Status"`
+}
+
+type podmanInspect struct {
+	RestartCount int `json:"RestartCount"`
+	State        struct {
+		Health      *podmanHealth `json:"Health"`
+		Healthcheck *podmanHealth `json:"Healthcheck"`
+	} `json:"State"`
+}
+
+type podmanStatsResponse struct {
+	Stats []struct {
+		ContainerID string  `json:"ContainerID"`
+		CPU         float64 `json:"CPU"`
+		MemUsage    uint64  `json:"MemUsage"`
+		MemLimit    uint64  `json:"MemLimit"`
+		NetInput    uint64  `json:"NetInput"`
+		NetOutput   uint64  `json:"NetOutput"`
+		BlockInput  uint64  `json:"BlockInput"`
+		BlockOutput uint64  `json:"BlockOutput"`
+		PIDs        uint64  `json:"PIDs"`
+	} `json:"Stats"`
+}
+
+// podmanAPI is the libpod REST prefix; Podman 5 still serves the v4 paths.
+const podmanAPI = "http://podman/v4.0.0/libpod"
+
+func readPodmanContainers(socket string) ([]containerInfo, error) {
+	client := newUnixHTTPClient(socket, 5*time.Second)
+	defer client.CloseIdleConnections()
+
+	var list []podmanContainer
+	if err := getJSON(client, podmanAPI+"/containers/json?all=true", &list); err != nil {
+		return nil, err
+	}
+
+	owner := podmanSocketOwner(socket)
+	result := make([]containerInfo, 0, len(list))
+	index := make(map[string]int, len(list))
+	query := url.Values{"stream": {"false"}}
+	for _, c := range list {
+		info := containerInfo{
+			ID:             shortContainerID(c.ID),
+			Runtime:        "podman",
+			Owner:          owner,
+			Pod:            c.PodName,
+			Image:          c.Image,
+			State:          c.State,
+			ComposeProject: firstNonEmpty(c.Labels["com.docker.compose.project"], c.Labels["io.podman.compose.project"]),
+			ComposeService: firstNonEmpty(c.Labels["com.docker.compose.service"], c.Labels["io.podman.compose.service"]),
+		}
+		if len(c.Names) > 0 {
+			info.Name = c.Names[0]
+		}
+		if c.State == "running" && c.StartedAt > 0 {
+			info.UptimeSeconds = int64(time.Since(time.Unix(c.StartedAt, 0)).Seconds())
+			query.Add("containers", c.ID)
+		}
+
+		var inspect podmanInspect
+		if err := getJSON(client, podmanAPI+"/containers/"+url.PathEscape(c.ID)+"/json", &inspect); err == nil {
+			info.RestartCount = inspect.RestartCount
+			if health := inspect.State.Health; health != nil {
+				info.Health = health.Status
+			} else if health := inspect.State.Healthcheck; health != nil {
+				info.Health = health.Status
+			}
+		}
+
+		index[c.ID] = len(result)
+		result = append(result, info)
+	}
+
+	if len(query["containers"]) == 0 {
+		return result, nil
+	}
+	var stats podmanStatsResponse
+	if err := getJSON(client, podmanAPI+"/containers/stats?"+query.Encode(), &stats); err != nil {
+		return result, err
+	}
+	for _, s := range stats.Stats {
+		i, ok := index[s.ContainerID]
+		if !ok {
+			continue
+		}
+		info := &result[i]
+		info.CPUPercent = s.CPU
+		info.MemoryUsedMB = float64(s.MemUsage) / (1024.0 * 1024.0)
+		info.MemoryLimitMB = float64(s.MemLimit) / (1024.0 * 1024.0)
+		info.MemoryPercent = percent(float64(s.MemUsage), float64(s.MemLimit))
+		info.NetRxBytes = s.NetInput
+		info.NetTxBytes = s.NetOutput
+		info.BlockReadBytes = s.BlockInput
+		info.BlockWriteBytes = s.BlockOutput
+		info.PIDs = s.PIDs
+	}
+	return result, nil
+}
+
+// podmanSocketOwner resolves the user of a rootless socket such as
+// /run/user/1000/podman/podman.sock. The system socket has no owner.
+func podmanSocketOwner(socket string) string {
+	rest, ok := strings.CutPrefix(socket, "/run/user/")
+	if !ok {
+		return ""
+	}
+	uid, _, _ := strings.Cut(rest, "/")
+	if u, err := user.LookupId(uid); err == nil {
+		return u.Username
+	}
+	return uid
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
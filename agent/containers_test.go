@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveUnix starts an HTTP server on a unix socket in a temporary directory
+// and returns the socket path.
+func serveUnix(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return socket
+}
+
+func fakeDockerAPI(t *testing.T) http.Handler {
+	started := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	responses := map[string]string{
+		"/containers/json": `[
+			{"Id": "aaaaaaaaaaaaaaaa", "Names": ["/web"], "Image": "nginx:1.27", "State": "running",
+			 "Labels": {"com.docker.compose.project": "site", "com.docker.compose.service": "web"}},
+			{"Id": "bbbbbbbbbbbbbbbb", "Names": ["/worker"], "Image": "worker:latest", "State": "restarting", "Labels": {}}
+		]`,
+		"/containers/aaaaaaaaaaaaaaaa/json": `{"RestartCount": 2, "State": {"Status": "running", "StartedAt": "` + started + `", "Health": {"Status": "unhealthy"}}}`,
+		"/containers/bbbbbbbbbbbbbbbb/json": `{"RestartCount": 7, "State": {"Status": "restarting", "StartedAt": "0001-01-01T00:00:00Z"}}`,
+		"/containers/aaaaaaaaaaaaaaaa/stats": `{
+			"cpu_stats": {"cpu_usage": {"total_usage": 400}, "system_cpu_usage": 2000, "online_cpus": 2},
+			"precpu_stats": {"cpu_usage": {"total_usage": 200}, "system_cpu_usage": 1000},
+			"memory_stats": {"usage": 209715200, "limit": 1073741824, "stats": {"inactive_file": 104857600}},
+			"networks": {"eth0": {"rx_bytes": 1000, "tx_bytes": 2000}, "eth1": {"rx_bytes": 10, "tx_bytes": 20}},
+			"blkio_stats": {"io_service_bytes_recursive": [{"op": "Read", "value": 4096}, {"op": "Write", "value": 8192}]},
+			"pids_stats": {"current": 5}
+		}`,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/containers/json" && r.URL.Query().Get("all") != "1" {
+			t.Errorf("containers listed without all=1")
+		}
+		if strings.HasSuffix(r.URL.Path, "/stats") && r.URL.Query().Get("stream") != "false" {
+			t.Errorf("stats requested as a stream")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+func TestReadDockerContainers(t *testing.T) {
+	socket := serveUnix(t, fakeDockerAPI(t))
+
+	containers, err := readDockerContainers(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("got %d containers, want 2", len(containers))
+	}
+
+	web := containers[0]
+	want := containerInfo{
+		ID:              "aaaaaaaaaaaa",
+		Runtime:         "docker",
+		Name:            "web",
+		Image:           "nginx:1.27",
+		State:           "running",
+		Health:          "unhealthy",
+		RestartCount:    2,
+		ComposeProject:  "site",
+		ComposeService:  "web",
+		CPUPercent:      40,
+		MemoryUsedMB:    100,
+		MemoryLimitMB:   1024,
+		MemoryPercent:   percent(100, 1024),
+		NetRxBytes:      1010,
+		NetTxBytes:      2020,
+		BlockReadBytes:  4096,
+		BlockWriteBytes: 8192,
+		PIDs:            5,
+	}
+	if web.UptimeSeconds < 3590 || web.UptimeSeconds > 3610 {
+		t.Errorf("uptime = %d, want about 3600", web.UptimeSeconds)
+	}
+	web.UptimeSeconds = 0
+	if web != want {
+		got, _ := json.Marshal(web)
+		expected, _ := json.Marshal(want)
+		t.Errorf("web container\n got %s\nwant %s", got, expected)
+	}
+
+	worker := containers[1]
+	if worker.Name != "worker" || worker.State != "restarting" || worker.RestartCount != 7 {
+		t.Errorf("worker container = %+v", worker)
+	}
+	// Stats are only requested for running containers.
+	if worker.CPUPercent != 0 || worker.MemoryUsedMB != 0 || worker.UptimeSeconds != 0 {
+		t.Errorf("worker container has stats: %+v", worker)
+	}
+}
+
+func TestReadDockerContainersUnreachable(t *testing.T) {
+	if _, err := readDockerContainers(filepath.Join(t.TempDir(), "missing.sock")); err == nil {
+		t.Fatal("expected an error for a missing socket")
+	}
+}
+
+// A Podman socket symlinked at the Docker path is queried once, through the
+// libpod API.
+func TestReadContainersSymlinkedPodmanSocket(t *testing.T) {
+	var dockerRequests int
+	socket := serveUnix(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v4.0.0/libpod/containers/json":
+			_, _ = w.Write([]byte(`[{"Id": "cccccccccccccccc", "Names": ["db"], "Image": "postgres:16", "State": "exited"}]`))
+		case "/v4.0.0/libpod/containers/cccccccccccccccc/json":
+			_, _ = w.Write([]byte(`{"RestartCount": 0, "State": {}}`))
+		default:
+			dockerRequests++
+			http.NotFound(w, r)
+		}
+	}))
+	dockerSocket := filepath.Join(t.TempDir(), "docker.sock")
+	if err := os.Symlink(socket, dockerSocket); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+	cfg.Containers.DockerSocket = dockerSocket
+	cfg.Containers.PodmanSockets = []string{socket}
+	cfg.Containers.ContainerdStateDirs = nil
+
+	containers, err := readContainers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Runtime != "podman" || containers[0].Name != "db" {
+		t.Errorf("containers = %+v, want db once under podman", containers)
+	}
+	if dockerRequests != 0 {
+		t.Errorf("%d requests went to the Docker API", dockerRequests)
+	}
+}
+
+func TestEvaluateContainersHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []containerInfo
+		status     string
+		reasons    []string
+	}{
+		{
+			name:       "healthy",
+			containers: []containerInfo{{Name: "web", State: "running", Health: "healthy"}},
+			status:     "ok",
+		},
+		{
+			name:       "unhealthy",
+			containers: []containerInfo{{Name: "web", State: "running", Health: "unhealthy"}},
+			status:     "warning",
+			reasons:    []string{"container 'web' unhealthy"},
+		},
+		{
+			name:       "restarting without a name",
+			containers: []containerInfo{{ID: "bbbbbbbbbbbb", State: "restarting"}},
+			status:     "warning",
+			reasons:    []string{"container 'bbbbbbbbbbbb' restarting"},
+		},
+		{
+			name:       "exited is not degraded",
+			containers: []containerInfo{{Name: "job", State: "exited"}},
+			status:     "ok",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := healthInfo{Status: "ok"}
+			evaluateContainersHealth(&health, tt.containers)
+			if health.Status != tt.status {
+				t.Errorf("status = %s, want %s", health.Status, tt.status)
+			}
+			if strings.Join(health.Reasons, "; ") != strings.Join(tt.reasons, "; ") {
+				t.Errorf("reasons = %q, want %q", health.Reasons, tt.reasons)
+			}
+		})
+	}
+}
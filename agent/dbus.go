@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal D-Bus client: EXTERNAL auth over the system bus unix socket and
+// synchronous method calls with string arguments. Replies are decoded into
+// plain Go values (strings, integers, []interface{}, map[string]interface{}).
+
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSignature   = 8
+)
+
+type dbusConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	serial uint32
+}
+
+type dbusMessage struct {
+	Type        byte
+	ReplySerial uint32
+	ErrorName   string
+	Body        []interface{}
+}
+
+func systemBusAddress() string {
+	addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+	if path, ok := strings.CutPrefix(addr, "unix:path="); ok {
+		path, _, _ = strings.Cut(path, ",")
+		return path
+	}
+	return "/run/dbus/system_bus_socket"
+}
+
+// dialSystemBus connects and authenticates to the system bus. The deadline
+// covers the whole lifetime of the connection.
+func dialSystemBus(timeout time.Duration) (*dbusConn, error) {
+	conn, err := net.DialTimeout("unix", systemBusAddress(), timeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &dbusConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := c.auth(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *dbusConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *dbusConn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := fmt.Fprintf(c.conn, "\x00AUTH EXTERNAL %s\r\n", uid); err != nil {
+		return err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus auth rejected: %s", strings.TrimSpace(line))
+	}
+	_, err = io.WriteString(c.conn, "BEGIN\r\n")
+	return err
+}
+
+// call invokes a method whose arguments are all strings and returns the
+// decoded reply body.
+func (c *dbusConn) call(dest, path, iface, member string, args ...string) ([]interface{}, error) {
+	c.serial++
+	serial := c.serial
+	if _, err := c.conn.Write(encodeDBusCall(serial, dest, path, iface, member, args)); err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		// Skip signals such as NameAcquired that arrive before the reply.
+		if msg.ReplySerial != serial {
+			continue
+		}
+		if msg.Type == dbusError {
+			detail := ""
+			if len(msg.Body) > 0 {
+				detail, _ = msg.Body[0].(string)
+			}
+			return nil, fmt.Errorf("%s: %s", msg.ErrorName, detail)
+		}
+		return msg.Body, nil
+	}
+}
+
+func (c *dbusConn) readMessage() (dbusMessage, error) {
+	head := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, head); err != nil {
+		return dbusMessage{}, err
+	}
+	var order binary.ByteOrder
+	switch head[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return dbusMessage{}, fmt.Errorf("dbus: invalid endianness %q", head[0])
+	}
+
+	bodyLen := order.Uint32(head[4:8])
+	fieldsLen := order.Uint32(head[12:16])
+	if bodyLen > 64<<20 || fieldsLen > 64<<20 {
+		return dbusMessage{}, fmt.Errorf("dbus: message too large")
+	}
+	headerLen := 16 + int(fieldsLen)
+	padded := (headerLen + 7) / 8 * 8
+	header := make([]byte, padded)
+	copy(header, head)
+	if _, err := io.ReadFull(c.reader, header[16:]); err != nil {
+		return dbusMessage{}, err
+	}
+	body := make([]byte, bodyLen)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return dbusMessage{}, err
+	}
+
+	msg := dbusMessage{Type: head[1]}
+	signature := ""
+	d := &dbusDecoder{data: header[:headerLen], pos: 16, order: order}
+	for d.pos < headerLen {
+		d.align(8)
+		code, err := d.value("y")
+		if err != nil {
+			return dbusMessage{}, err
+		}
+		value, err := d.value("v")
+		if err != nil {
+			return dbusMessage{}, err
+		}
+		switch code.(byte) {
+		case dbusFieldErrorName:
+			msg.ErrorName, _ = value.(string)
+		case dbusFieldReplySerial:
+			msg.ReplySerial, _ = value.(uint32)
+		case dbusFieldSignature:
+			signature, _ = value.(string)
+		}
+	}
+
+	d = &dbusDecoder{data: body, order: order}
+	for signature != "" {
+		typ, rest, err := nextDBusType(signature)
+		if err != nil {
+			return dbusMessage{}, err
+		}
+		value, err := d.value(typ)
+		if err != nil {
+			return dbusMessage{}, err
+		}
+		msg.Body = append(msg.Body, value)
+		signature = rest
+	}
+	return msg, nil
+}
+
+type dbusEncoder struct {
+	buf []byte
+}
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *dbusEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func (e *dbusEncoder) signature(s string) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func encodeDBusCall(serial uint32, dest, path, iface, member string, args []string) []byte {
+	body := &dbusEncoder{}
+	for _, arg := range args {
+		body.string(arg)
+	}
+
+	e := &dbusEncoder{buf: []byte{'l', dbusMethodCall, 0, 1}}
+	e.uint32(uint32(len(body.buf)))
+	e.uint32(serial)
+
+	lenPos := len(e.buf)
+	e.uint32(0)
+	start := len(e.buf)
+	field := func(code byte, sig, value string) {
+		e.align(8)
+		e.buf = append(e.buf, code)
+		e.signature(sig)
+		if sig == "g" {
+			e.signature(value)
+		} else {
+			e.string(value)
+		}
+	}
+	field(dbusFieldPath, "o", path)
+	field(dbusFieldDestination, "s", dest)
+	if iface != "" {
+		field(dbusFieldInterface, "s", iface)
+	}
+	field(dbusFieldMember, "s", member)
+	if len(args) > 0 {
+		field(dbusFieldSignature, "g", strings.Repeat("s", len(args)))
+	}
+	binary.LittleEndian.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-start))
+	e.align(8)
+
+	return append(e.buf, body.buf...)
+}
+
+type dbusDecoder struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (d *dbusDecoder) align(n int) {
+	d.pos = (d.pos + n - 1) / n * n
+}
+
+func (d *dbusDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *dbusDecoder) fixed(align, size int) ([]byte, error) {
+	d.align(align)
+	return d.read(size)
+}
+
+// value decodes one complete type, e.g. "s", "a{sv}" or "(so)".
+func (d *dbusDecoder) value(typ string) (interface{}, error) {
+	switch typ[0] {
+	case 'y':
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		b, err := d.fixed(4, 4)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint32(b) != 0, nil
+	case 'n':
+		b, err := d.fixed(2, 2)
+		if err != nil {
+			return nil, err
+		}
+		return int16(d.order.Uint16(b)), nil
+	case 'q':
+		b, err := d.fixed(2, 2)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint16(b), nil
+	case 'i':
+		b, err := d.fixed(4, 4)
+		if err != nil {
+			return nil, err
+		}
+		return int32(d.order.Uint32(b)), nil
+	case 'u', 'h':
+		b, err := d.fixed(4, 4)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint32(b), nil
+	case 'x':
+		b, err := d.fixed(8, 8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(d.order.Uint64(b)), nil
+	case 't':
+		b, err := d.fixed(8, 8)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint64(b), nil
+	case 'd':
+		b, err := d.fixed(8, 8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(d.order.Uint64(b)), nil
+	case 's', 'o':
+		b, err := d.fixed(4, 4)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.read(int(d.order.Uint32(b)) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'g':
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.read(int(b[0]) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'v':
+		sig, err := d.value("g")
+		if err != nil {
+			return nil, err
+		}
+		inner, rest, err := nextDBusType(sig.(string))
+		if err != nil || rest != "" {
+			return nil, fmt.Errorf("dbus: invalid variant signature %q", sig)
+		}
+		return d.value(inner)
+	case 'a':
+		return d.array(typ[1:])
+	case '(':
+		d.align(8)
+		var fields []interface{}
+		sig := typ[1 : len(typ)-1]
+		for sig != "" {
+			inner, rest, err := nextDBusType(sig)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(inner)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+			sig = rest
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("dbus: unsupported type %q", typ)
+}
+
+// array decodes a{..} dictionaries with string keys into maps and every
+// other array into a slice.
+func (d *dbusDecoder) array(elem string) (interface{}, error) {
+	b, err := d.fixed(4, 4)
+	if err != nil {
+		return nil, err
+	}
+	length := int(d.order.Uint32(b))
+	d.align(dbusAlignment(elem[0]))
+	end := d.pos + length
+	if end > len(d.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if elem[0] == '{' {
+		keyType, valueType, err := nextDBusType(elem[1 : len(elem)-1])
+		if err != nil {
+			return nil, err
+		}
+		dict := make(map[string]interface{})
+		for d.pos < end {
+			d.align(8)
+			key, err := d.value(keyType)
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.value(valueType)
+			if err != nil {
+				return nil, err
+			}
+			dict[fmt.Sprint(key)] = value
+		}
+		return dict, nil
+	}
+
+	var items []interface{}
+	for d.pos < end {
+		v, err := d.value(elem)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func dbusAlignment(t byte) int {
+	switch t {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 'h', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 1
+}
+
+// nextDBusType splits the first complete type off a signature.
+func nextDBusType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("dbus: empty signature")
+	}
+	switch sig[0] {
+	case 'a':
+		elem, rest, err := nextDBusType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '(', '{':
+		depth := 0
+		for i := 0; i < len(sig); i++ {
+			switch sig[i] {
+			case '(', '{':
+				depth++
+			case ')', '}':
+				depth--
+				if depth == 0 {
+					return sig[:i+1], sig[i+1:], nil
+				}
+			}
+		}
+		return "", "", fmt.Errorf("dbus: unbalanced signature %q", sig)
+	}
+	return sig[:1], sig[1:], nil
+}
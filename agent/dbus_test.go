@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDBusCall(t *testing.T) {
+	// Worked out by hand from the D-Bus specification.
+	want := strings.Join([]string{
+		"6c010001", "06000000", "02000000", "47000000", // header: body 6 bytes, serial 2, fields 71 bytes
+		"01016f00", "02000000", "2f7000", // PATH "/p"
+		"0000000000", "06017300", "03000000", "612e6200", // DESTINATION "a.b"
+		"00000000", "02017300", "03000000", "612e6200", // INTERFACE "a.b"
+		"00000000", "03017300", "01000000", "4d00", // MEMBER "M"
+		"000000000000", "08016700", "017300", // SIGNATURE "s"
+		"00", "01000000", "7800", // padding, body "x"
+	}, "")
+	got := hex.EncodeToString(encodeDBusCall(2, "a.b", "/p", "a.b", "M", []string{"x"}))
+	if got != want {
+		t.Errorf("encodeDBusCall\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestEncodeDBusCallWithoutArgs(t *testing.T) {
+	msg := encodeDBusCall(1, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", nil)
+	if binary.LittleEndian.Uint32(msg[4:8]) != 0 {
+		t.Errorf("body length = %d, want 0", binary.LittleEndian.Uint32(msg[4:8]))
+	}
+	if len(msg)%8 != 0 {
+		t.Errorf("message length %d is not padded to 8", len(msg))
+	}
+	if strings.Contains(string(msg), "\x08\x01g\x00") {
+		t.Error("message without arguments has a SIGNATURE field")
+	}
+}
+
+func TestDBusDecoderValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   string
+		order binary.ByteOrder
+		data  string
+		want  interface{}
+	}{
+		{"byte", "y", binary.LittleEndian, "2a", byte(42)},
+		{"bool", "b", binary.LittleEndian, "01000000", true},
+		{"int16", "n", binary.LittleEndian, "feff", int16(-2)},
+		{"uint16", "q", binary.BigEndian, "0102", uint16(0x0102)},
+		{"int32", "i", binary.LittleEndian, "ffffffff", int32(-1)},
+		{"uint32", "u", binary.BigEndian, "00000007", uint32(7)},
+		{"int64", "x", binary.LittleEndian, "feffffffffffffff", int64(-2)},
+		{"uint64", "t", binary.LittleEndian, "0100000000000000", uint64(1)},
+		{"double", "d", binary.LittleEndian, "000000000000f83f", 1.5},
+		{"string", "s", binary.LittleEndian, "03000000666f6f00", "foo"},
+		{"string big endian", "s", binary.BigEndian, "00000003666f6f00", "foo"},
+		{"object path", "o", binary.LittleEndian, "020000002f6100", "/a"},
+		{"signature", "g", binary.LittleEndian, "02617300", "as"},
+		{"variant string", "v", binary.LittleEndian, "0173000002000000686900", "hi"},
+		// The uint64 inside the variant is aligned to 8 from the message start.
+		{"variant uint64", "v", binary.LittleEndian, "017400" + "0000000000" + "0500000000000000", uint64(5)},
+		{"string array", "as", binary.LittleEndian, "0e000000" + "010000006100" + "0000" + "010000006200", []interface{}{"a", "b"}},
+		{"empty array", "as", binary.LittleEndian, "00000000", []interface{}(nil)},
+		{"struct", "(so)", binary.LittleEndian, "0100000078000000" + "020000002f7900", []interface{}{"x", "/y"}},
+		{
+			"dict of variants", "a{sv}", binary.LittleEndian,
+			"21000000" + "00000000" + // length 33, padding to 8
+				"010000006100" + "017500" + "000000" + "07000000" + // "a": variant u 7
+				"010000006200" + "017300" + "000000" + "0000000000", // "b": variant s ""
+			map[string]interface{}{"a": uint32(7), "b": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatalf("bad test data: %v", err)
+			}
+			d := &dbusDecoder{data: data, order: tt.order}
+			got, err := d.value(tt.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("value(%q) = %#v, want %#v", tt.typ, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBusDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  string
+		data string
+	}{
+		{"truncated uint32", "u", "0100"},
+		{"string longer than data", "s", "10000000616200"},
+		{"array longer than data", "as", "40000000"},
+		{"variant with two types", "v", "02737300"},
+		{"unsupported type", "z", "00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.data)
+			d := &dbusDecoder{data: data, order: binary.LittleEndian}
+			if _, err := d.value(tt.typ); err == nil {
+				t.Errorf("value(%q) succeeded on %s", tt.typ, tt.data)
+			}
+		})
+	}
+}
+
+func TestNextDBusType(t *testing.T) {
+	tests := []struct {
+		sig, typ, rest string
+		err            bool
+	}{
+		{sig: "su", typ: "s", rest: "u"},
+		{sig: "a{sv}u", typ: "a{sv}", rest: "u"},
+		{sig: "a(ssssssouso)", typ: "a(ssssssouso)", rest: ""},
+		{sig: "(s(ii))x", typ: "(s(ii))", rest: "x"},
+		{sig: "aas", typ: "aas", rest: ""},
+		{sig: "", err: true},
+		{sig: "(ss", err: true},
+		{sig: "a", err: true},
+	}
+	for _, tt := range tests {
+		typ, rest, err := nextDBusType(tt.sig)
+		if (err != nil) != tt.err || typ != tt.typ || rest != tt.rest {
+			t.Errorf("nextDBusType(%q) = %q, %q, %v", tt.sig, typ, rest, err)
+		}
+	}
+}
+
+// dbusTestEncoder builds message bodies the agent only ever decodes.
+type dbusTestEncoder struct {
+	dbusEncoder
+}
+
+func (e *dbusTestEncoder) uint64(v uint64) {
+	e.align(8)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, v)
+}
+
+// array writes an array whose elements are aligned to elemAlign.
+func (e *dbusTestEncoder) array(elemAlign int, elems func()) {
+	e.uint32(0)
+	lenPos := len(e.buf) - 4
+	e.align(elemAlign)
+	start := len(e.buf)
+	elems()
+	binary.LittleEndian.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-start))
+}
+
+// properties encodes an a{sv} of string and uint64 values.
+func (e *dbusTestEncoder) properties(props map[string]interface{}) {
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	e.array(8, func() {
+		for _, key := range keys {
+			e.align(8)
+			e.string(key)
+			switch v := props[key].(type) {
+			case string:
+				e.signature("s")
+				e.string(v)
+			case uint64:
+				e.signature("t")
+				e.uint64(v)
+			case uint32:
+				e.signature("u")
+				e.uint32(v)
+			}
+		}
+	})
+}
+
+// dbusTestMessage builds a little-endian message with the header fields
+// the agent reads.
+func dbusTestMessage(msgType byte, replySerial uint32, errorName, member, sig string, body []byte) []byte {
+	e := &dbusEncoder{buf: []byte{'l', msgType, 0, 1}}
+	e.uint32(uint32(len(body)))
+	e.uint32(1000 + replySerial)
+	e.uint32(0)
+	start := len(e.buf)
+	if replySerial != 0 {
+		e.align(8)
+		e.buf = append(e.buf, dbusFieldReplySerial)
+		e.signature("u")
+		e.uint32(replySerial)
+	}
+	if errorName != "" {
+		e.align(8)
+		e.buf = append(e.buf, dbusFieldErrorName)
+		e.signature("s")
+		e.string(errorName)
+	}
+	if member != "" {
+		e.align(8)
+		e.buf = append(e.buf, dbusFieldMember)
+		e.signature("s")
+		e.string(member)
+	}
+	if sig != "" {
+		e.align(8)
+		e.buf = append(e.buf, dbusFieldSignature)
+		e.signature("g")
+		e.signature(sig)
+	}
+	binary.LittleEndian.PutUint32(e.buf[12:16], uint32(len(e.buf)-start))
+	e.align(8)
+	return append(e.buf, body...)
+}
+
+func TestReadMessage(t *testing.T) {
+	body := &dbusTestEncoder{}
+	body.string("/org/freedesktop/systemd1/unit/nginx_2eservice")
+	reply := dbusTestMessage(dbusMethodReturn, 7, "", "", "o", body.buf)
+
+	errBody := &dbusTestEncoder{}
+	errBody.string("Unit nope.service not found.")
+	errReply := dbusTestMessage(dbusError, 8, "org.freedesktop.systemd1.NoSuchUnit", "", "s", errBody.buf)
+
+	c := &dbusConn{reader: bufio.NewReader(strings.NewReader(string(reply) + string(errReply)))}
+	msg, err := c.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dbusMessage{Type: dbusMethodReturn, ReplySerial: 7, Body: []interface{}{"/org/freedesktop/systemd1/unit/nginx_2eservice"}}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("reply = %#v, want %#v", msg, want)
+	}
+
+	msg, err = c.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = dbusMessage{Type: dbusError, ReplySerial: 8, ErrorName: "org.freedesktop.systemd1.NoSuchUnit", Body: []interface{}{"Unit nope.service not found."}}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("error = %#v, want %#v", msg, want)
+	}
+
+	if _, err := c.readMessage(); !errors.Is(err, io.EOF) {
+		t.Errorf("read past the end = %v, want EOF", err)
+	}
+}
+
+func TestReadMessageRejectsBadHeader(t *testing.T) {
+	bad := dbusTestMessage(dbusMethodReturn, 1, "", "", "", nil)
+	bad[0] = 'x'
+	c := &dbusConn{reader: bufio.NewReader(strings.NewReader(string(bad)))}
+	if _, err := c.readMessage(); err == nil {
+		t.Error("message with invalid endianness accepted")
+	}
+
+	huge := dbusTestMessage(dbusMethodReturn, 1, "", "", "", nil)
+	binary.LittleEndian.PutUint32(huge[4:8], 1<<30)
+	c = &dbusConn{reader: bufio.NewReader(strings.NewReader(string(huge)))}
+	if _, err := c.readMessage(); err == nil {
+		t.Error("oversized message accepted")
+	}
+}
+
+// fakeSystemd is a system bus that answers the calls readSystemdUnit makes.
+type fakeSystemd struct {
+	t      *testing.T
+	auth   chan string
+	authOK bool
+}
+
+func (f *fakeSystemd) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	f.auth <- line
+	if !f.authOK {
+		_, _ = io.WriteString(conn, "REJECTED EXTERNAL\r\n")
+		return
+	}
+	_, _ = io.WriteString(conn, "OK 0123456789abcdef0123456789abcdef\r\n")
+	if line, err := reader.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		f.t.Errorf("expected BEGIN, got %q (%v)", line, err)
+		return
+	}
+
+	for {
+		serial, path, member, args, err := readTestCall(reader)
+		if err != nil {
+			return
+		}
+		var reply []byte
+		body := &dbusTestEncoder{}
+		switch {
+		case member == "Hello":
+			// A signal before the reply must be skipped by call.
+			body.string(":1.42")
+			_, _ = conn.Write(dbusTestMessage(4, 0, "", "NameAcquired", "s", body.buf))
+			reply = dbusTestMessage(dbusMethodReturn, serial, "", "", "s", body.buf)
+		case member == "ListUnits":
+			body.array(8, func() {
+				for _, unit := range [][2]string{{"nginx.service", "active"}, {"backup.service", "failed"}} {
+					body.align(8)
+					for _, s := range []string{unit[0], "desc", "loaded", unit[1], "running", ""} {
+						body.string(s)
+					}
+					body.string("/unit")
+					body.uint32(0)
+					body.string("")
+					body.string("/")
+				}
+			})
+			reply = dbusTestMessage(dbusMethodReturn, serial, "", "", "a(ssssssouso)", body.buf)
+		case member == "LoadUnit" && args[0] == "missing.service":
+			body.string("Unit missing.service not found.")
+			reply = dbusTestMessage(dbusError, serial, "org.freedesktop.systemd1.NoSuchUnit", "", "s", body.buf)
+		case member == "LoadUnit" && args[0] == "empty.service":
+			reply = dbusTestMessage(dbusMethodReturn, serial, "", "", "", nil)
+		case member == "LoadUnit" && args[0] == "odd.service":
+			body.uint32(7)
+			reply = dbusTestMessage(dbusMethodReturn, serial, "", "", "u", body.buf)
+		case member == "LoadUnit":
+			body.string("/org/freedesktop/systemd1/unit/" + strings.ReplaceAll(args[0], ".", "_2e"))
+			reply = dbusTestMessage(dbusMethodReturn, serial, "", "", "o", body.buf)
+		case member == "GetAll":
+			body.properties(fakeUnitProperties(path, args[0]))
+			reply = dbusTestMessage(dbusMethodReturn, serial, "", "", "a{sv}", body.buf)
+		default:
+			f.t.Errorf("unexpected call %s", member)
+			return
+		}
+		if _, err := conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+func fakeUnitProperties(path, iface string) map[string]interface{} {
+	failed := strings.HasSuffix(path, "backup_2eservice")
+	switch iface {
+	case "org.freedesktop.systemd1.Unit":
+		active, sub := "active", "running"
+		if failed {
+			active, sub = "failed", "failed"
+		}
+		return map[string]interface{}{
+			"LoadState":            "loaded",
+			"ActiveState":          active,
+			"SubState":             sub,
+			"StateChangeTimestamp": uint64(1700000000000000),
+		}
+	case "org.freedesktop.systemd1.Service":
+		result := "success"
+		if failed {
+			result = "exit-code"
+		}
+		return map[string]interface{}{"Result": result, "NRestarts": uint32(3)}
+	case "org.freedesktop.systemd1.Timer":
+		return map[string]interface{}{
+			"Result":                 "success",
+			"LastTriggerUSec":        uint64(1700000000000000),
+			"NextElapseUSecRealtime": uint64(math.MaxUint64),
+		}
+	}
+	return map[string]interface{}{}
+}
+
+// readTestCall decodes a method call as the bus daemon would.
+func readTestCall(reader *bufio.Reader) (serial uint32, path, member string, args []string, err error) {
+	head := make([]byte, 16)
+	if _, err = io.ReadFull(reader, head); err != nil {
+		return
+	}
+	if head[0] != 'l' || head[1] != dbusMethodCall {
+		err = fmt.Errorf("unexpected message % x", head[:4])
+		return
+	}
+	bodyLen := binary.LittleEndian.Uint32(head[4:8])
+	serial = binary.LittleEndian.Uint32(head[8:12])
+	fieldsLen := int(binary.LittleEndian.Uint32(head[12:16]))
+	header := make([]byte, (16+fieldsLen+7)/8*8)
+	copy(header, head)
+	if _, err = io.ReadFull(reader, header[16:]); err != nil {
+		return
+	}
+	body := make([]byte, bodyLen)
+	if _, err = io.ReadFull(reader, body); err != nil {
+		return
+	}
+
+	d := &dbusDecoder{data: header[:16+fieldsLen], pos: 16, order: binary.LittleEndian}
+	signature := ""
+	for d.pos < 16+fieldsLen {
+		d.align(8)
+		code, _ := d.value("y")
+		var value interface{}
+		if value, err = d.value("v"); err != nil {
+			return
+		}
+		switch code.(byte) {
+		case dbusFieldPath:
+			path, _ = value.(string)
+		case dbusFieldMember:
+			member, _ = value.(string)
+		case dbusFieldSignature:
+			signature, _ = value.(string)
+		}
+	}
+	d = &dbusDecoder{data: body, order: binary.LittleEndian}
+	for range signature {
+		var value interface{}
+		if value, err = d.value("s"); err != nil {
+			return
+		}
+		args = append(args, value.(string))
+	}
+	return
+}
+
+func startFakeBus(t *testing.T, bus *fakeSystemd) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "system_bus_socket")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path="+socket+",guid=0123")
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go bus.serve(conn)
+		}
+	}()
+}
+
+func TestSystemBusUnits(t *testing.T) {
+	bus := &fakeSystemd{t: t, auth: make(chan string, 1), authOK: true}
+	startFakeBus(t, bus)
+
+	conn, err := dialSystemBus(2 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	wantAuth := "\x00AUTH EXTERNAL " + hex.EncodeToString([]byte(strconv.Itoa(os.Getuid()))) + "\r\n"
+	if line := <-bus.auth; line != wantAuth {
+		t.Errorf("auth line = %q, want %q", line, wantAuth)
+	}
+
+	reply, err := conn.call(systemdDest, systemdPath, systemdManager, "ListUnits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	units, _ := reply[0].([]interface{})
+	if len(units) != 2 {
+		t.Fatalf("ListUnits returned %d units, want 2", len(units))
+	}
+	if fields := units[1].([]interface{}); fields[0] != "backup.service" || fields[3] != "failed" || fields[7] != uint32(0) {
+		t.Errorf("second unit = %#v", fields)
+	}
+
+	tests := []struct {
+		name string
+		want systemdUnitInfo
+	}{
+		{"nginx.service", systemdUnitInfo{
+			Name: "nginx.service", LoadState: "loaded", ActiveState: "active", SubState: "running",
+			Result: "success", Restarts: 3, StateChangedAt: "2023-11-14T22:13:20Z",
+		}},
+		{"backup.service", systemdUnitInfo{
+			Name: "backup.service", LoadState: "loaded", ActiveState: "failed", SubState: "failed",
+			Result: "exit-code", Restarts: 3, StateChangedAt: "2023-11-14T22:13:20Z",
+		}},
+		{"backup.timer", systemdUnitInfo{
+			Name: "backup.timer", LoadState: "loaded", ActiveState: "active", SubState: "running",
+			Result: "success", StateChangedAt: "2023-11-14T22:13:20Z", LastTriggerAt: "2023-11-14T22:13:20Z",
+		}},
+		{"missing.service", systemdUnitInfo{
+			Name: "missing.service", Error: "org.freedesktop.systemd1.NoSuchUnit: Unit missing.service not found.",
+		}},
+		{"empty.service", systemdUnitInfo{Name: "empty.service", Error: "empty LoadUnit reply for empty.service"}},
+		{"odd.service", systemdUnitInfo{Name: "odd.service", Error: "unexpected LoadUnit reply for odd.service"}},
+	}
+	var info systemdInfo
+	for _, tt := range tests {
+		got := readSystemdUnit(conn, tt.name)
+		if got != tt.want {
+			t.Errorf("readSystemdUnit(%s)\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+		info.Units = append(info.Units, got)
+	}
+
+	health := healthInfo{Status: "ok"}
+	evaluateSystemdHealth(&health, &info)
+	if health.Status != "critical" || len(health.Reasons) != 1 || health.Reasons[0] != "unit 'backup.service' failed" {
+		t.Errorf("health = %+v", health)
+	}
+}
+
+func TestSystemBusAuthRejected(t *testing.T) {
+	startFakeBus(t, &fakeSystemd{t: t, auth: make(chan string, 1)})
+	conn, err := dialSystemBus(2 * time.Second)
+	if err == nil {
+		conn.Close()
+		t.Fatal("dial succeeded after REJECTED")
+	}
+	if !strings.Contains(err.Error(), "dbus auth rejected") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestSystemBusAddress(t *testing.T) {
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "")
+	if got := systemBusAddress(); got != "/run/dbus/system_bus_socket" {
+		t.Errorf("default address = %s", got)
+	}
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path=/tmp/bus,guid=abc")
+	if got := systemBusAddress(); got != "/tmp/bus" {
+		t.Errorf("address = %s, want /tmp/bus", got)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxEvents bounds the in-memory event log; the oldest events are dropped.
+const maxEvents = 100
+
+type eventsConfig struct {
+	// Retention is how long events are listed in the payload.
+	Retention duration `json:"retention"`
+	// HealthWindow is how long a warning or critical event affects health.
+	HealthWindow duration `json:"health_window"`
+}
+
+// eventInfo is a state change the agent noticed between two samples, as
+// opposed to a condition that is visible in a single sample.
+type eventInfo struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Severity string    `json:"severity"`
+	Message  string    `json:"message"`
+}
+
+type eventLog struct {
+	mu     sync.Mutex
+	events []eventInfo
+}
+
+var events = &eventLog{}
+
+func (l *eventLog) record(kind, severity, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, eventInfo{
+		Time:     time.Now().UTC(),
+		Kind:     kind,
+		Severity: severity,
+		Message:  message,
+	})
+	if len(l.events) > maxEvents {
+		l.events = append([]eventInfo(nil), l.events[len(l.events)-maxEvents:]...)
+	}
+}
+
+// since returns events newer than t, oldest first.
+func (l *eventLog) since(t time.Time) []eventInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var result []eventInfo
+	for _, event := range l.events {
+		if event.Time.After(t) {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+func readEvents(now time.Time) []eventInfo {
+	return events.since(now.Add(-cfg.Events.Retention.Duration))
+}
+
+func evaluateEventsHealth(health *healthInfo, recent []eventInfo, now time.Time) {
+	cutoff := now.Add(-cfg.Events.HealthWindow.Duration)
+	for _, event := range recent {
+		if event.Time.After(cutoff) && healthLevels[event.Severity] > 0 {
+			health.degrade(event.Severity, event.Message)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// statfsWorkers bounds how many statfs calls may be outstanding at once,
+// including calls stuck on an unresponsive mount.
+const statfsWorkers = 8
+
+var (
+	errStatfsTimeout = errors.New("statfs timed out")
+	errStatfsBusy    = errors.New("no statfs worker free before the timeout")
+)
+
+type filesystemsConfig struct {
+	StatfsTimeout duration `json:"statfs_timeout"`
+	// SkipNetwork leaves network filesystems out entirely; otherwise they are
+	// statted at most once per NetworkInterval (0 means on every request).
+	SkipNetwork     bool     `json:"skip_network"`
+	NetworkInterval duration `json:"network_interval"`
+	// A mount is reported when it matches Include (or Include is empty) and
+	// does not match Exclude.
+	Include filesystemFilter `json:"include"`
+	Exclude filesystemFilter `json:"exclude"`
+	// DedupeBinds reports a device mounted in several places (bind mounts)
+	// only once, at its shortest mount point.
+	DedupeBinds bool `json:"dedupe_binds"`
+	// FSUsageLimit caps fs_usage in /metrics to the fullest mounts; 0 is no limit.
+	FSUsageLimit int            `json:"fs_usage_limit"`
+	Required     []string       `json:"required"`
+	Forecast     forecastConfig `json:"forecast"`
+}
+
+// filesystemFilter matches a mount when any of its glob patterns matches.
+type filesystemFilter struct {
+	Mounts  []string `json:"mounts"`
+	FSTypes []string `json:"fstypes"`
+	Devices []string `json:"devices"`
+}
+
+type requiredMountInfo struct {
+	Mount  string `json:"mount"`
+	Status string `json:"status"`
+	Device string `json:"device,omitempty"`
+	FSType string `json:"fstype,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// defaultExcludedFSTypes are pseudo filesystems that never hold user data.
+var defaultExcludedFSTypes = []string{
+	"proc", "sysfs", "devtmpfs", "tmpfs", "cgroup", "cgroup2", "devpts",
+	"overlay", "squashfs", "rpc_pipefs", "fusectl", "autofs",
+}
+
+var networkFSTypes = map[string]bool{
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "smbfs": true,
+	"9p": true, "ceph": true, "glusterfs": true, "lustre": true, "afs": true,
+	"davfs": true, "fuse.sshfs": true, "fuse.glusterfs": true, "fuse.ceph": true,
+	"fuse.s3fs": true, "fuse.rclone": true,
+}
+
+// mountEntry is one line of /proc/self/mountinfo; see proc(5).
+type mountEntry struct {
+	ID       int
+	ParentID int
+	// DevID is "major:minor" of the filesystem; bind mounts share it.
+	DevID string
+	// Root is the directory of the filesystem mounted here, "/" unless this
+	// is a bind mount of a subdirectory.
+	Root         string
+	Mount        string
+	Options      []string
+	Propagation  []string
+	FSType       string
+	Device       string
+	SuperOptions []string
+}
+
+func (m mountEntry) network() bool {
+	return networkFSTypes[m.FSType]
+}
+
+// readonly reports whether either the mount or its superblock is read-only.
+func (m mountEntry) readonly() bool {
+	return hasMountOption(m.Options, "ro") || hasMountOption(m.SuperOptions, "ro")
+}
+
+func hasMountOption(options []string, name string) bool {
+	for _, option := range options {
+		if option == name {
+			return true
+		}
+	}
+	return false
+}
+
+func readMounts() ([]mountEntry, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	var mounts []mountEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if mount, ok := parseMountInfoLine(line); ok {
+			mounts = append(mounts, mount)
+		}
+	}
+	return mounts, nil
+}
+
+// parseMountInfoLine parses
+//
+//	36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+// where a variable number of optional fields ends at the "-" separator.
+func parseMountInfoLine(line string) (mountEntry, bool) {
+	fields := strings.Fields(line)
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 || len(fields) < sep+4 {
+		return mountEntry{}, false
+	}
+	mount := mountEntry{
+		DevID:        fields[2],
+		Root:         unescapeMountField(fields[3]),
+		Mount:        unescapeMountField(fields[4]),
+		Options:      strings.Split(fields[5], ","),
+		Propagation:  fields[6:sep],
+		FSType:       fields[sep+1],
+		Device:       unescapeMountField(fields[sep+2]),
+		SuperOptions: strings.Split(fields[sep+3], ","),
+	}
+	mount.ID, _ = strconv.Atoi(fields[0])
+	mount.ParentID, _ = strconv.Atoi(fields[1])
+	return mount, true
+}
+
+// unescapeMountField decodes the octal escapes (\040 for space, \011, \012
+// and \134) the kernel uses for whitespace and backslashes in paths.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+type statfsCall struct {
+	started time.Time
+	done    chan struct{}
+	stat    syscall.Statfs_t
+	err     error
+}
+
+type statfsCached struct {
+	at   time.Time
+	stat syscall.Statfs_t
+}
+
+// statfsPool runs statfs off the request path. A call that hangs (e.g. on
+// a dead NFS server) cannot be cancelled, so it stays in flight holding a
+// worker slot; later requests see it and report the mount stale at once
+// instead of piling up more stuck goroutines.
+type statfsPool struct {
+	mu       sync.Mutex
+	inflight map[string]*statfsCall
+	cached   map[string]statfsCached
+	slots    chan struct{}
+}
+
+var statfsWorkerPool = &statfsPool{
+	inflight: map[string]*statfsCall{},
+	cached:   map[string]statfsCached{},
+	slots:    make(chan struct{}, statfsWorkers),
+}
+
+func (p *statfsPool) stat(path string, network bool) (syscall.Statfs_t, error) {
+	timeout := cfg.Filesystems.StatfsTimeout.Duration
+	deadline := time.Now().Add(timeout)
+
+	p.mu.Lock()
+	if network && cfg.Filesystems.NetworkInterval.Duration > 0 {
+		if c, ok := p.cached[path]; ok && time.Since(c.at) < cfg.Filesystems.NetworkInterval.Duration {
+			p.mu.Unlock()
+			return c.stat, nil
+		}
+	}
+	call, ok := p.inflight[path]
+	if ok && time.Since(call.started) >= timeout {
+		p.mu.Unlock()
+		return syscall.Statfs_t{}, errStatfsTimeout
+	}
+	if !ok {
+		// Wait for a slot within the same timeout; slots only stay taken
+		// for long when mounts hang.
+		p.mu.Unlock()
+		if !p.acquire(deadline) {
+			return syscall.Statfs_t{}, errStatfsBusy
+		}
+		p.mu.Lock()
+		if call, ok = p.inflight[path]; ok {
+			<-p.slots
+		} else {
+			call = &statfsCall{started: time.Now(), done: make(chan struct{})}
+			p.inflight[path] = call
+			go p.run(path, call, network)
+		}
+	}
+	p.mu.Unlock()
+
+	if expiry := call.started.Add(timeout); expiry.Before(deadline) {
+		deadline = expiry
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-call.done:
+		return call.stat, call.err
+	case <-timer.C:
+		return syscall.Statfs_t{}, errStatfsTimeout
+	}
+}
+
+func (p *statfsPool) acquire(deadline time.Time) bool {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (p *statfsPool) run(path string, call *statfsCall, network bool) {
+	call.err = syscall.Statfs(path, &call.stat)
+
+	p.mu.Lock()
+	delete(p.inflight, path)
+	if call.err == nil && network {
+		p.cached[path] = statfsCached{at: time.Now(), stat: call.stat}
+	}
+	p.mu.Unlock()
+	<-p.slots
+	close(call.done)
+}
+
+type mountStat struct {
+	mountEntry
+	stat syscall.Statfs_t
+	err  error
+}
+
+// statMounts statfs's the mounts concurrently, so unresponsive mounts cost
+// one timeout in total rather than one each.
+func statMounts(mounts []mountEntry) []mountStat {
+	result := make([]mountStat, len(mounts))
+	var wg sync.WaitGroup
+	for i, mount := range mounts {
+		result[i].mountEntry = mount
+		wg.Add(1)
+		go func(s *mountStat) {
+			defer wg.Done()
+			s.stat, s.err = statfsWorkerPool.stat(s.Mount, s.network())
+		}(&result[i])
+	}
+	wg.Wait()
+	return result
+}
+
+func (f filesystemFilter) empty() bool {
+	return len(f.Mounts)+len(f.FSTypes)+len(f.Devices) == 0
+}
+
+func (f filesystemFilter) matches(m mountEntry) bool {
+	return matchAnyGlob(f.Mounts, m.Mount) || matchAnyGlob(f.FSTypes, m.FSType) ||
+		matchAnyGlob(f.Devices, m.Device)
+}
+
+func (f filesystemFilter) validate() error {
+	for _, list := range [][]string{f.Mounts, f.FSTypes, f.Devices} {
+		for _, pattern := range list {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("bad pattern %q", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+func (c filesystemsConfig) validate() error {
+	if c.StatfsTimeout.Duration <= 0 {
+		return fmt.Errorf("statfs_timeout must be positive")
+	}
+	if c.Forecast.Enabled && c.Forecast.SampleInterval.Duration <= 0 {
+		return fmt.Errorf("forecast.sample_interval must be positive")
+	}
+	if err := c.Include.validate(); err != nil {
+		return fmt.Errorf("include: %w", err)
+	}
+	if err := c.Exclude.validate(); err != nil {
+		return fmt.Errorf("exclude: %w", err)
+	}
+	return nil
+}
+
+func matchAnyGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// usableMounts applies the include/exclude filters and the network
+// setting, then collapses bind mounts of the same device.
+func usableMounts(mounts []mountEntry) []mountEntry {
+	conf := cfg.Filesystems
+	var result []mountEntry
+	for _, mount := range mounts {
+		if !conf.Include.empty() && !conf.Include.matches(mount) {
+			continue
+		}
+		if conf.Exclude.matches(mount) {
+			continue
+		}
+		if conf.SkipNetwork && mount.network() {
+			continue
+		}
+		result = append(result, mount)
+	}
+	if conf.DedupeBinds {
+		result = dedupeBindMounts(result)
+	}
+	return result
+}
+
+// dedupeBindMounts keeps the shortest mount point per filesystem, so bind
+// mounts of the same device are reported once.
+func dedupeBindMounts(mounts []mountEntry) []mountEntry {
+	shortest := map[string]int{}
+	for i, mount := range mounts {
+		if j, ok := shortest[mount.DevID]; !ok || len(mount.Mount) < len(mounts[j].Mount) {
+			shortest[mount.DevID] = i
+		}
+	}
+	var result []mountEntry
+	for i, mount := range mounts {
+		if shortest[mount.DevID] != i {
+			continue
+		}
+		result = append(result, mount)
+	}
+	return result
+}
+
+// readRequiredMounts checks that every required mount point is mounted,
+// responsive and writable. Filters do not apply to required mounts.
+func readRequiredMounts(mounts []mountEntry) []requiredMountInfo {
+	if len(cfg.Filesystems.Required) == 0 {
+		return nil
+	}
+	// The last entry for a mount point is the one visible on top.
+	byMount := map[string]mountEntry{}
+	for _, mount := range mounts {
+		byMount[mount.Mount] = mount
+	}
+
+	result := make([]requiredMountInfo, 0, len(cfg.Filesystems.Required))
+	for _, required := range cfg.Filesystems.Required {
+		info := requiredMountInfo{Mount: filepath.Clean(required), Status: "ok"}
+		mount, ok := byMount[info.Mount]
+		if !ok {
+			info.Status = "missing"
+			result = append(result, info)
+			continue
+		}
+		info.Device, info.FSType = mount.Device, mount.FSType
+		stat, err := statfsWorkerPool.stat(mount.Mount, mount.network())
+		// The mount is in mountinfo, so a failed statfs says nothing about
+		// whether it is mounted.
+		switch {
+		case err == errStatfsTimeout || err == errStatfsBusy:
+			info.Status = "stale"
+		case err != nil:
+			info.Status = "unknown"
+			info.Error = err.Error()
+		case stat.Flags&stRdonly != 0:
+			info.Status = "readonly"
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+var (
+	readonlyMu    sync.Mutex
+	readonlyState = map[string]bool{}
+)
+
+// trackReadonlyFlips records an event when a mount that was writable in the
+// previous sample is now read-only, which is how ext4 reacts to I/O errors
+// with errors=remount-ro.
+func trackReadonlyFlips(fs []diskFSInfo) {
+	readonlyMu.Lock()
+	defer readonlyMu.Unlock()
+	for _, f := range fs {
+		if wasReadonly, seen := readonlyState[f.Mount]; seen && !wasReadonly && f.Readonly {
+			events.record("fs_readonly", "critical", fmt.Sprintf("filesystem %s remounted read-only", f.Mount))
+		}
+		readonlyState[f.Mount] = f.Readonly
+	}
+}
+
+// stRdonly is ST_RDONLY in statfs f_flags.
+const stRdonly = 0x1
+
+func evaluateFilesystemHealth(health *healthInfo, disk diskInfo) {
+	for _, f := range disk.FS {
+		if f.Stale {
+			health.degrade("warning", fmt.Sprintf("mount %s not responding", f.Mount))
+		}
+	}
+	for _, r := range disk.Required {
+		switch r.Status {
+		case "missing":
+			health.degrade("critical", fmt.Sprintf("required mount %s is not mounted", r.Mount))
+		case "readonly":
+			health.degrade("critical", fmt.Sprintf("required mount %s is read-only", r.Mount))
+		case "stale":
+			health.degrade("critical", fmt.Sprintf("required mount %s not responding", r.Mount))
+		case "unknown":
+			health.degrade("critical", fmt.Sprintf("required mount %s could not be checked: %s", r.Mount, r.Error))
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStatfsPool(workers int) *statfsPool {
+	return &statfsPool{
+		inflight: map[string]*statfsCall{},
+		cached:   map[string]statfsCached{},
+		slots:    make(chan struct{}, workers),
+	}
+}
+
+func useStatfsTimeout(t *testing.T, timeout time.Duration) {
+	saved, savedPool := cfg, statfsWorkerPool
+	t.Cleanup(func() { cfg, statfsWorkerPool = saved, savedPool })
+	cfg = defaultConfig()
+	cfg.Filesystems.StatfsTimeout = duration{timeout}
+}
+
+// Far more mounts than workers all get statted: callers queue for a slot
+// instead of failing.
+func TestStatMountsMoreThanWorkers(t *testing.T) {
+	useStatfsTimeout(t, 5*time.Second)
+	statfsWorkerPool = newTestStatfsPool(statfsWorkers)
+
+	dir := t.TempDir()
+	mounts := make([]mountEntry, 300)
+	for i := range mounts {
+		mounts[i] = mountEntry{Mount: filepath.Join(dir, fmt.Sprint(i)), FSType: "ext4"}
+		if err := os.Mkdir(mounts[i].Mount, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range statMounts(mounts) {
+		if m.err != nil {
+			t.Fatalf("statfs %s: %v", m.Mount, m.err)
+		}
+		if m.stat.Blocks == 0 {
+			t.Fatalf("statfs %s returned no blocks", m.Mount)
+		}
+	}
+	if n := len(statfsWorkerPool.slots); n != 0 {
+		t.Errorf("%d slots still held", n)
+	}
+}
+
+func TestStatfsPoolWaitsForSlot(t *testing.T) {
+	useStatfsTimeout(t, 2*time.Second)
+	pool := newTestStatfsPool(1)
+	pool.slots <- struct{}{}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-pool.slots
+	}()
+	if _, err := pool.stat(t.TempDir(), false); err != nil {
+		t.Fatalf("stat after a slot was freed: %v", err)
+	}
+}
+
+func TestStatfsPoolBusyUntilTimeout(t *testing.T) {
+	useStatfsTimeout(t, 100*time.Millisecond)
+	pool := newTestStatfsPool(1)
+	pool.slots <- struct{}{}
+	start := time.Now()
+	if _, err := pool.stat(t.TempDir(), false); err != errStatfsBusy {
+		t.Fatalf("err = %v, want errStatfsBusy", err)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("gave up after %s, before the timeout", waited)
+	}
+}
+
+func TestReadRequiredMounts(t *testing.T) {
+	useStatfsTimeout(t, 100*time.Millisecond)
+	statfsWorkerPool = newTestStatfsPool(statfsWorkers)
+
+	dir := t.TempDir()
+	gone := filepath.Join(dir, "gone")
+	mounts := []mountEntry{
+		{Mount: dir, FSType: "ext4", Device: "/dev/sda1"},
+		// In mountinfo but statfs fails, e.g. in another mount namespace.
+		{Mount: gone, FSType: "ext4", Device: "/dev/sdb1"},
+	}
+	cfg.Filesystems.Required = []string{dir + "/", gone, "/not/mounted"}
+
+	got := readRequiredMounts(mounts)
+	want := []requiredMountInfo{
+		{Mount: dir, Status: "ok", Device: "/dev/sda1", FSType: "ext4"},
+		{Mount: gone, Status: "unknown", Device: "/dev/sdb1", FSType: "ext4", Error: "no such file or directory"},
+		{Mount: "/not/mounted", Status: "missing"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readRequiredMounts\n got %+v\nwant %+v", got, want)
+	}
+
+	// With every worker stuck the mount is stale, not missing.
+	pool := newTestStatfsPool(1)
+	pool.slots <- struct{}{}
+	statfsWorkerPool = pool
+	cfg.Filesystems.Required = []string{dir}
+	got = readRequiredMounts(mounts)
+	if len(got) != 1 || got[0].Status != "stale" {
+		t.Errorf("with no free worker = %+v, want stale", got)
+	}
+
+	health := healthInfo{Status: "ok"}
+	evaluateFilesystemHealth(&health, diskInfo{Required: want})
+	wantReasons := []string{
+		"required mount " + gone + " could not be checked: no such file or directory",
+		"required mount /not/mounted is not mounted",
+	}
+	if health.Status != "critical" || !reflect.DeepEqual(health.Reasons, wantReasons) {
+		t.Errorf("health = %+v, want critical with %q", health, wantReasons)
+	}
+}
+
+func TestParseMountInfoLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want mountEntry
+		ok   bool
+	}{
+		{
+			name: "optional fields before the separator",
+			line: "36 35 98:0 /mnt1 /mnt/parent rw,noatime shared:1 master:2 - ext3 /dev/root rw,errors=continue",
+			want: mountEntry{
+				ID: 36, ParentID: 35, DevID: "98:0", Root: "/mnt1", Mount: "/mnt/parent",
+				Options: []string{"rw", "noatime"}, Propagation: []string{"shared:1", "master:2"},
+				FSType: "ext3", Device: "/dev/root", SuperOptions: []string{"rw", "errors=continue"},
+			},
+			ok: true,
+		},
+		{
+			name: "no optional fields",
+			line: "25 1 259:2 / / rw,relatime - ext4 /dev/nvme0n1p2 rw",
+			want: mountEntry{
+				ID: 25, ParentID: 1, DevID: "259:2", Root: "/", Mount: "/",
+				Options: []string{"rw", "relatime"}, Propagation: []string{},
+				FSType: "ext4", Device: "/dev/nvme0n1p2", SuperOptions: []string{"rw"},
+			},
+			ok: true,
+		},
+		{
+			name: "escaped paths",
+			line: `90 25 0:50 /share /mnt/my\040share rw shared:40 - cifs //nas/my\040share rw,vers=3.0`,
+			want: mountEntry{
+				ID: 90, ParentID: 25, DevID: "0:50", Root: "/share", Mount: "/mnt/my share",
+				Options: []string{"rw"}, Propagation: []string{"shared:40"},
+				FSType: "cifs", Device: "//nas/my share", SuperOptions: []string{"rw", "vers=3.0"},
+			},
+			ok: true,
+		},
+		{name: "missing separator", line: "25 1 259:2 / / rw,relatime ext4 /dev/nvme0n1p2 rw"},
+		{name: "truncated after separator", line: "25 1 259:2 / / rw,relatime - ext4"},
+		{name: "empty", line: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseMountInfoLine(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMountInfoLine\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnescapeMountField(t *testing.T) {
+	tests := []struct {
+		field, want string
+	}{
+		{"/mnt/data", "/mnt/data"},
+		{`/mnt/my\040disk`, "/mnt/my disk"},
+		{`/mnt/tab\011here`, "/mnt/tab\there"},
+		{`/mnt/new\012line`, "/mnt/new\nline"},
+		{`/mnt/back\134slash`, `/mnt/back\slash`},
+		{`/mnt/a\040b\040c`, "/mnt/a b c"},
+		{`/mnt/not\08octal`, `/mnt/not\08octal`},
+		{`/mnt/short\04`, `/mnt/short\04`},
+	}
+	for _, tt := range tests {
+		if got := unescapeMountField(tt.field); got != tt.want {
+			t.Errorf("unescapeMountField(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestMountEntryReadonly(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      string
+		superOptions string
+		want         bool
+	}{
+		{"writable", "rw,relatime", "rw", false},
+		{"read-only mount", "ro,relatime", "rw", true},
+		{"read-only superblock", "rw,relatime", "ro", true},
+		// errors=remount-ro is a policy, not the current state.
+		{"remount-ro policy", "rw,relatime", "rw,errors=remount-ro", false},
+		{"remount-ro after an error", "rw,relatime", "ro,errors=remount-ro", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mountEntry{Options: strings.Split(tt.options, ","), SuperOptions: strings.Split(tt.superOptions, ",")}
+			if got := m.readonly(); got != tt.want {
+				t.Errorf("readonly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackReadonlyFlips(t *testing.T) {
+	savedEvents, savedState := events, readonlyState
+	t.Cleanup(func() { events, readonlyState = savedEvents, savedState })
+	events = &eventLog{}
+	readonlyState = map[string]bool{}
+
+	// The first sample only sets the baseline, even for a read-only mount.
+	trackReadonlyFlips([]diskFSInfo{{Mount: "/"}, {Mount: "/data"}, {Mount: "/boot", Readonly: true}})
+	trackReadonlyFlips([]diskFSInfo{{Mount: "/"}, {Mount: "/data", Readonly: true}, {Mount: "/boot", Readonly: true}})
+	// Staying read-only or becoming writable again records nothing.
+	trackReadonlyFlips([]diskFSInfo{{Mount: "/"}, {Mount: "/data", Readonly: true}, {Mount: "/boot"}})
+
+	got := events.since(time.Time{})
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1: %+v", len(got), got)
+	}
+	if got[0].Kind != "fs_readonly" || got[0].Severity != "critical" || got[0].Message != "filesystem /data remounted read-only" {
+		t.Errorf("event = %+v", got[0])
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const fsHistoryStateFile = "fs_history.json"
+
+// Forecasts need enough history to tell growth from noise.
+const (
+	forecastMinSamples = 6
+	forecastMinSpan    = time.Hour
+)
+
+type forecastConfig struct {
+	Enabled        bool     `json:"enabled"`
+	SampleInterval duration `json:"sample_interval"`
+	Window         duration `json:"window"`
+	// A filesystem forecast to fill within WarnWithin is a warning, within
+	// CriticalWithin critical. Zero disables the rule.
+	WarnWithin     duration `json:"warn_within"`
+	CriticalWithin duration `json:"critical_within"`
+}
+
+type fsSample struct {
+	Time   int64  `json:"t"`
+	Used   uint64 `json:"u"`
+	Inodes uint64 `json:"i,omitempty"`
+}
+
+// fsSeries is the usage history of one mount. Size and InodesTotal are the
+// latest capacity, which forecasts are measured against.
+type fsSeries struct {
+	Size        uint64     `json:"size"`
+	InodesTotal uint64     `json:"inodes_total,omitempty"`
+	Samples     []fsSample `json:"samples"`
+}
+
+type fsHistory struct {
+	mu     sync.Mutex
+	series map[string]*fsSeries
+}
+
+var fsUsageHistory = &fsHistory{series: map[string]*fsSeries{}}
+
+// runFSSampler records usage of every reported mount once per
+// sample_interval and persists the history so restarts keep it.
+func runFSSampler() {
+	if !cfg.Filesystems.Forecast.Enabled {
+		return
+	}
+	series := map[string]*fsSeries{}
+	if err := readState(fsHistoryStateFile, &series); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("load filesystem history failed: %v", err)
+	}
+	if series != nil {
+		fsUsageHistory.mu.Lock()
+		fsUsageHistory.series = series
+		fsUsageHistory.mu.Unlock()
+	}
+
+	ticker := time.NewTicker(cfg.Filesystems.Forecast.SampleInterval.Duration)
+	defer ticker.Stop()
+	for {
+		if err := fsUsageHistory.sample(time.Now()); err != nil {
+			log.Printf("sample filesystem usage failed: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+func (h *fsHistory) sample(now time.Time) error {
+	mounts, err := readMounts()
+	if err != nil {
+		return err
+	}
+	stats := statMounts(usableMounts(mounts))
+	cutoff := now.Add(-cfg.Filesystems.Forecast.Window.Duration).Unix()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	seen := map[string]bool{}
+	for _, m := range stats {
+		seen[m.Mount] = true
+		if m.err != nil || m.stat.Blocks == 0 {
+			continue
+		}
+		s := h.series[m.Mount]
+		if s == nil {
+			s = &fsSeries{}
+			h.series[m.Mount] = s
+		}
+		s.Size = m.stat.Blocks * uint64(m.stat.Bsize)
+		s.InodesTotal = m.stat.Files
+		s.Samples = append(s.Samples, fsSample{
+			Time:   now.Unix(),
+			Used:   (m.stat.Blocks - m.stat.Bavail) * uint64(m.stat.Bsize),
+			Inodes: m.stat.Files - m.stat.Ffree,
+		})
+		for len(s.Samples) > 0 && s.Samples[0].Time < cutoff {
+			s.Samples = s.Samples[1:]
+		}
+	}
+	// Forget mounts that are gone.
+	for mount := range h.series {
+		if !seen[mount] {
+			delete(h.series, mount)
+		}
+	}
+	return writeState(fsHistoryStateFile, h.series)
+}
+
+// applyForecasts fills growth and time-to-full from the mount's history.
+func applyForecasts(fs []diskFSInfo, now time.Time) {
+	if !cfg.Filesystems.Forecast.Enabled {
+		return
+	}
+	fsUsageHistory.mu.Lock()
+	defer fsUsageHistory.mu.Unlock()
+	for i := range fs {
+		s := fsUsageHistory.series[fs[i].Mount]
+		if s == nil || len(s.Samples) < forecastMinSamples {
+			continue
+		}
+		first, last := s.Samples[0], s.Samples[len(s.Samples)-1]
+		if time.Duration(last.Time-first.Time)*time.Second < forecastMinSpan {
+			continue
+		}
+
+		slope := fitSamples(s.Samples, func(p fsSample) float64 { return float64(p.Used) })
+		fs[i].GrowthBytesPerHour = slope
+		fs[i].ForecastFullAt = forecastFull(float64(last.Used), float64(s.Size), slope, last.Time)
+		if s.InodesTotal > 0 {
+			inodeSlope := fitSamples(s.Samples, func(p fsSample) float64 { return float64(p.Inodes) })
+			fs[i].InodesForecastFullAt = forecastFull(float64(last.Inodes), float64(s.InodesTotal), inodeSlope, last.Time)
+		}
+	}
+}
+
+// fitSamples returns the least-squares slope of value over time, per hour,
+// or 0 with fewer than two samples.
+func fitSamples(samples []fsSample, value func(fsSample) float64) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	n := float64(len(samples))
+	origin := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, p := range samples {
+		x := float64(p.Time-origin) / 3600
+		y := value(p)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denom
+}
+
+// forecastFull extrapolates when used reaches total. Shrinking or flat
+// usage never fills and yields "".
+func forecastFull(used, total, perHour float64, at int64) string {
+	if perHour <= 0 || total <= used {
+		return ""
+	}
+	hours := (total - used) / perHour
+	// Beyond ten years a forecast says nothing useful.
+	if hours > 10*365*24 {
+		return ""
+	}
+	full := time.Unix(at, 0).Add(time.Duration(hours * float64(time.Hour)))
+	return full.UTC().Format(time.RFC3339)
+}
+
+func evaluateForecastHealth(health *healthInfo, fs []diskFSInfo, now time.Time) {
+	conf := cfg.Filesystems.Forecast
+	for _, f := range fs {
+		for _, forecast := range []struct{ what, at string }{
+			{"filesystem", f.ForecastFullAt},
+			{"inodes on", f.InodesForecastFullAt},
+		} {
+			if forecast.at == "" {
+				continue
+			}
+			full, err := time.Parse(time.RFC3339, forecast.at)
+			if err != nil {
+				continue
+			}
+			left := full.Sub(now)
+			switch {
+			case conf.CriticalWithin.Duration > 0 && left <= conf.CriticalWithin.Duration:
+				health.degrade("critical", fmt.Sprintf("%s %s forecast full in %.0fh", forecast.what, f.Mount, left.Hours()))
+			case conf.WarnWithin.Duration > 0 && left <= conf.WarnWithin.Duration:
+				health.degrade("warning", fmt.Sprintf("%s %s forecast full in %.0fh", forecast.what, f.Mount, left.Hours()))
+			}
+		}
+	}
+}
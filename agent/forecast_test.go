@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// hourlySamples returns one sample per hour starting at t0 with the given
+// used bytes and inodes.
+func hourlySamples(t0 int64, used, inodes []uint64) []fsSample {
+	samples := make([]fsSample, len(used))
+	for i := range used {
+		samples[i] = fsSample{Time: t0 + int64(i)*3600, Used: used[i]}
+		if inodes != nil {
+			samples[i].Inodes = inodes[i]
+		}
+	}
+	return samples
+}
+
+func TestFitSamples(t *testing.T) {
+	used := func(p fsSample) float64 { return float64(p.Used) }
+	tests := []struct {
+		name    string
+		samples []fsSample
+		want    float64
+	}{
+		{"steady growth", hourlySamples(0, []uint64{100, 200, 300, 400}, nil), 100},
+		{"noisy growth", hourlySamples(0, []uint64{100, 250, 250, 400}, nil), 90},
+		{"flat", hourlySamples(0, []uint64{500, 500, 500}, nil), 0},
+		{"shrinking", hourlySamples(0, []uint64{400, 300, 200}, nil), -100},
+		{"half-hourly", []fsSample{{Time: 0, Used: 0}, {Time: 1800, Used: 50}, {Time: 3600, Used: 100}}, 100},
+		{"single sample", hourlySamples(0, []uint64{100}, nil), 0},
+		{"no samples", nil, 0},
+		{"same timestamp", []fsSample{{Time: 60, Used: 1}, {Time: 60, Used: 2}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitSamples(tt.samples, used); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("fitSamples = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForecastFull(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC).Unix()
+	tests := []struct {
+		name    string
+		used    float64
+		total   float64
+		perHour float64
+		want    string
+	}{
+		{"fills in ten hours", 900, 1000, 10, "2024-06-01T22:00:00Z"},
+		{"flat usage", 900, 1000, 0, ""},
+		{"shrinking usage", 900, 1000, -5, ""},
+		{"already full", 1000, 1000, 10, ""},
+		{"beyond ten years", 0, 1e12, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forecastFull(tt.used, tt.total, tt.perHour, at); got != tt.want {
+				t.Errorf("forecastFull = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyForecasts(t *testing.T) {
+	saved, savedHistory := cfg, fsUsageHistory
+	t.Cleanup(func() { cfg, fsUsageHistory = saved, savedHistory })
+	cfg = defaultConfig()
+
+	t0 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).Unix()
+	fsUsageHistory = &fsHistory{series: map[string]*fsSeries{
+		// Bytes grow 100/h with 400 left; inodes grow 10/h with 50 left.
+		"/": {Size: 1000, InodesTotal: 100, Samples: hourlySamples(t0,
+			[]uint64{100, 200, 300, 400, 500, 600}, []uint64{0, 10, 20, 30, 40, 50})},
+		"/flat": {Size: 1000, Samples: hourlySamples(t0, []uint64{300, 300, 300, 300, 300, 300}, nil)},
+		"/shrinking": {Size: 1000, InodesTotal: 100, Samples: hourlySamples(t0,
+			[]uint64{600, 500, 400, 300, 200, 100}, []uint64{50, 50, 50, 50, 50, 50})},
+		"/young": {Size: 1000, Samples: hourlySamples(t0, []uint64{100, 200}, nil)},
+		"/short": {Size: 1000, Samples: []fsSample{
+			{Time: t0, Used: 1}, {Time: t0 + 60, Used: 2}, {Time: t0 + 120, Used: 3},
+			{Time: t0 + 180, Used: 4}, {Time: t0 + 240, Used: 5}, {Time: t0 + 300, Used: 6},
+		}},
+	}}
+
+	fs := []diskFSInfo{{Mount: "/"}, {Mount: "/flat"}, {Mount: "/shrinking"}, {Mount: "/young"}, {Mount: "/short"}, {Mount: "/new"}}
+	applyForecasts(fs, time.Unix(t0, 0))
+
+	want := []diskFSInfo{
+		{Mount: "/", GrowthBytesPerHour: 100, ForecastFullAt: "2024-06-01T09:00:00Z", InodesForecastFullAt: "2024-06-01T10:00:00Z"},
+		{Mount: "/flat"},
+		{Mount: "/shrinking", GrowthBytesPerHour: -100},
+		// Too few samples, or too short a span, for a forecast.
+		{Mount: "/young"},
+		{Mount: "/short"},
+		{Mount: "/new"},
+	}
+	if !reflect.DeepEqual(fs, want) {
+		t.Errorf("applyForecasts\n got %+v\nwant %+v", fs, want)
+	}
+}
+
+func TestEvaluateForecastHealth(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	in := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+	tests := []struct {
+		name    string
+		fs      diskFSInfo
+		status  string
+		reasons []string
+	}{
+		{"no forecast", diskFSInfo{Mount: "/"}, "ok", nil},
+		{"far off", diskFSInfo{Mount: "/", ForecastFullAt: in(30 * 24 * time.Hour)}, "ok", nil},
+		{"within warn_within", diskFSInfo{Mount: "/", ForecastFullAt: in(24 * time.Hour)}, "warning",
+			[]string{"filesystem / forecast full in 24h"}},
+		{"within critical_within", diskFSInfo{Mount: "/var", ForecastFullAt: in(2 * time.Hour)}, "critical",
+			[]string{"filesystem /var forecast full in 2h"}},
+		{"inodes", diskFSInfo{Mount: "/srv", InodesForecastFullAt: in(5 * time.Hour)}, "critical",
+			[]string{"inodes on /srv forecast full in 5h"}},
+		{"unparsable", diskFSInfo{Mount: "/", ForecastFullAt: "soon"}, "ok", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := healthInfo{Status: "ok"}
+			evaluateForecastHealth(&health, []diskFSInfo{tt.fs}, now)
+			if health.Status != tt.status || !reflect.DeepEqual(health.Reasons, tt.reasons) {
+				t.Errorf("health = %s %q, want %s %q", health.Status, health.Reasons, tt.status, tt.reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// Minimal generic netlink client: one request at a time over a raw
+// NETLINK_GENERIC socket, with replies returned as attribute payloads.
+
+const (
+	genlIDCtrl         = 0x10
+	genlHeaderLen      = 4
+	ctrlCmdGetFamily   = 3
+	ctrlAttrFamilyID   = 1
+	ctrlAttrFamilyName = 2
+
+	nlaFNested       = 0x8000
+	nlaFNetByteorder = 0x4000
+	nlaHeaderLen     = 4
+)
+
+type genlConn struct {
+	fd  int
+	seq uint32
+}
+
+type netlinkAttr struct {
+	Type  uint16
+	Value []byte
+}
+
+func dialGenetlink(timeout time.Duration) (*genlConn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_GENERIC)
+	if err != nil {
+		return nil, err
+	}
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	for _, opt := range []int{syscall.SO_RCVTIMEO, syscall.SO_SNDTIMEO} {
+		if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, opt, &tv); err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &genlConn{fd: fd}, nil
+}
+
+func (c *genlConn) Close() error {
+	return syscall.Close(c.fd)
+}
+
+// execute sends one request and returns the attributes of every reply
+// message, following multipart replies until NLMSG_DONE.
+func (c *genlConn) execute(family uint16, cmd, version uint8, flags uint16, attrs []byte) ([][]byte, error) {
+	c.seq++
+	msg := make([]byte, syscall.NLMSG_HDRLEN+genlHeaderLen, syscall.NLMSG_HDRLEN+genlHeaderLen+len(attrs))
+	binary.NativeEndian.PutUint16(msg[4:6], family)
+	binary.NativeEndian.PutUint16(msg[6:8], syscall.NLM_F_REQUEST|flags)
+	binary.NativeEndian.PutUint32(msg[8:12], c.seq)
+	msg[16] = cmd
+	msg[17] = version
+	msg = append(msg, attrs...)
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(len(msg)))
+	if err := syscall.Sendto(c.fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var replies [][]byte
+	buf := make([]byte, 1<<16)
+	for {
+		n, _, err := syscall.Recvfrom(c.fd, buf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != c.seq {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return replies, nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) < 4 {
+					return nil, fmt.Errorf("short netlink error")
+				}
+				if code := int32(binary.NativeEndian.Uint32(m.Data[:4])); code != 0 {
+					return nil, syscall.Errno(-code)
+				}
+				return replies, nil
+			}
+			if len(m.Data) < genlHeaderLen {
+				return nil, fmt.Errorf("short generic netlink message")
+			}
+			replies = append(replies, m.Data[genlHeaderLen:])
+			if m.Header.Flags&syscall.NLM_F_MULTI == 0 {
+				return replies, nil
+			}
+		}
+	}
+}
+
+// resolveFamily looks up the ID of a generic netlink family by name.
+func (c *genlConn) resolveFamily(name string) (uint16, error) {
+	replies, err := c.execute(genlIDCtrl, ctrlCmdGetFamily, 1, 0, appendNetlinkAttr(nil, ctrlAttrFamilyName, netlinkString(name)))
+	if err != nil {
+		return 0, fmt.Errorf("resolve %s family: %w", name, err)
+	}
+	for _, reply := range replies {
+		for _, attr := range parseNetlinkAttrs(reply) {
+			if attr.Type == ctrlAttrFamilyID && len(attr.Value) >= 2 {
+				return binary.NativeEndian.Uint16(attr.Value), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("resolve %s family: no family id", name)
+}
+
+func appendNetlinkAttr(b []byte, typ uint16, value []byte) []byte {
+	length := nlaHeaderLen + len(value)
+	b = binary.NativeEndian.AppendUint16(b, uint16(length))
+	b = binary.NativeEndian.AppendUint16(b, typ)
+	b = append(b, value...)
+	for ; length%4 != 0; length++ {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// parseNetlinkAttrs splits an attribute stream. Nested and byte-order
+// flags are stripped from the type; truncated trailing data is ignored.
+func parseNetlinkAttrs(b []byte) []netlinkAttr {
+	var attrs []netlinkAttr
+	for len(b) >= nlaHeaderLen {
+		length := int(binary.NativeEndian.Uint16(b[0:2]))
+		if length < nlaHeaderLen || length > len(b) {
+			break
+		}
+		attrs = append(attrs, netlinkAttr{
+			Type:  binary.NativeEndian.Uint16(b[2:4]) &^ (nlaFNested | nlaFNetByteorder),
+			Value: b[nlaHeaderLen:length],
+		})
+		aligned := (length + 3) &^ 3
+		if aligned > len(b) {
+			break
+		}
+		b = b[aligned:]
+	}
+	return attrs
+}
+
+func netlinkString(s string) []byte {
+	return append([]byte(s), 0)
+}
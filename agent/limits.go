@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type limitsConfig struct {
+	Enabled bool `json:"enabled"`
+	// A kernel table at WarnPercent of its limit is a warning, at
+	// CriticalPercent critical.
+	WarnPercent     float64 `json:"warn_percent"`
+	CriticalPercent float64 `json:"critical_percent"`
+}
+
+// kernelLimitInfo is the usage of one kernel table against its limit.
+type kernelLimitInfo struct {
+	Name        string  `json:"name"`
+	Used        uint64  `json:"used"`
+	Max         uint64  `json:"max"`
+	UsedPercent float64 `json:"used_percent"`
+	// User is set for per-user limits and names the user closest to it.
+	User string `json:"user,omitempty"`
+}
+
+func (c limitsConfig) validate() error {
+	if c.WarnPercent <= 0 || c.WarnPercent > 100 || c.CriticalPercent <= 0 || c.CriticalPercent > 100 {
+		return fmt.Errorf("warn_percent and critical_percent must be between 0 and 100")
+	}
+	if c.WarnPercent > c.CriticalPercent {
+		return fmt.Errorf("warn_percent must not exceed critical_percent")
+	}
+	return nil
+}
+
+// readLimits reports kernel tables against their limits; inotify usage is
+// counted from fds, the descriptor walk of this collection.
+func readLimits(fds []procFD) []kernelLimitInfo {
+	if !cfg.Limits.Enabled {
+		return nil
+	}
+	var limits []kernelLimitInfo
+	add := func(name string, used, max uint64, user string) {
+		if max == 0 {
+			return
+		}
+		limits = append(limits, kernelLimitInfo{
+			Name:        name,
+			Used:        used,
+			Max:         max,
+			UsedPercent: percent(float64(used), float64(max)),
+			User:        user,
+		})
+	}
+
+	// The conntrack files only exist while nf_conntrack is loaded.
+	if count, ok := readSysfsUint("/proc/sys/net/netfilter/nf_conntrack_count"); ok {
+		max, _ := readSysfsUint("/proc/sys/net/netfilter/nf_conntrack_max")
+		add("conntrack", count, max, "")
+	}
+
+	if used, max, ok := parseFileNr(readSysfsString("/proc/sys/fs/file-nr")); ok {
+		add("file_handles", used, max, "")
+	}
+
+	// Every thread takes a PID, so threads count against both pid_max and
+	// threads-max.
+	if threads, ok := parseLoadavgThreads(readSysfsString("/proc/loadavg")); ok {
+		pidMax, _ := readSysfsUint("/proc/sys/kernel/pid_max")
+		threadsMax, _ := readSysfsUint("/proc/sys/kernel/threads-max")
+		add("pid_max", threads, pidMax, "")
+		add("threads_max", threads, threadsMax, "")
+	}
+
+	watches, instances := countInotify(fds)
+	maxWatches, _ := readSysfsUint("/proc/sys/fs/inotify/max_user_watches")
+	maxInstances, _ := readSysfsUint("/proc/sys/fs/inotify/max_user_instances")
+	if uid, used := busiestUser(watches); uid != "" {
+		add("inotify_watches", used, maxWatches, lookupUserName(uid))
+	}
+	if uid, used := busiestUser(instances); uid != "" {
+		add("inotify_instances", used, maxInstances, lookupUserName(uid))
+	}
+	return limits
+}
+
+func readSysfsUint(path string) (uint64, bool) {
+	value, err := strconv.ParseUint(readSysfsString(path), 10, 64)
+	return value, err == nil
+}
+
+// parseFileNr parses /proc/sys/fs/file-nr, "allocated unused max"; unused
+// has been 0 since Linux 2.6.
+func parseFileNr(value string) (uint64, uint64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		return 0, 0, false
+	}
+	allocated, err1 := strconv.ParseUint(fields[0], 10, 64)
+	unused, err2 := strconv.ParseUint(fields[1], 10, 64)
+	max, err3 := strconv.ParseUint(fields[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || unused > allocated {
+		return 0, 0, false
+	}
+	return allocated - unused, max, true
+}
+
+// parseLoadavgThreads returns the thread count from the fourth
+// /proc/loadavg field, "running/total".
+func parseLoadavgThreads(value string) (uint64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return 0, false
+	}
+	_, total, ok := strings.Cut(fields[3], "/")
+	if !ok {
+		return 0, false
+	}
+	threads, err := strconv.ParseUint(total, 10, 64)
+	return threads, err == nil
+}
+
+// countInotify counts inotify instances per UID from the descriptor walk
+// and their watches in /proc/<pid>/fdinfo. Processes the agent may not
+// inspect are skipped.
+func countInotify(fds []procFD) (map[string]uint64, map[string]uint64) {
+	watches := map[string]uint64{}
+	instances := map[string]uint64{}
+	uids := map[int]string{}
+	for _, fd := range fds {
+		if fd.Target != "anon_inode:inotify" {
+			continue
+		}
+		pid := strconv.Itoa(fd.PID)
+		uid, ok := uids[fd.PID]
+		if !ok {
+			uid = readProcUID(pid)
+			uids[fd.PID] = uid
+		}
+		if uid == "" {
+			continue
+		}
+		instances[uid]++
+		info, err := os.ReadFile(filepath.Join(procRoot, pid, "fdinfo", fd.FD))
+		if err != nil {
+			continue
+		}
+		watches[uid] += uint64(strings.Count(string(info), "inotify wd:"))
+	}
+	return watches, instances
+}
+
+func busiestUser(counts map[string]uint64) (string, uint64) {
+	var uid string
+	var most uint64
+	for user, count := range counts {
+		if uid == "" || count > most || (count == most && user < uid) {
+			uid, most = user, count
+		}
+	}
+	return uid, most
+}
+
+func evaluateLimitsHealth(health *healthInfo, limits []kernelLimitInfo) {
+	for _, l := range limits {
+		name := l.Name
+		if l.User != "" {
+			name = fmt.Sprintf("%s of %s", l.Name, l.User)
+		}
+		switch {
+		case l.UsedPercent >= cfg.Limits.CriticalPercent:
+			health.degrade("critical", fmt.Sprintf("%s at %.0f%% (%d/%d)", name, l.UsedPercent, l.Used, l.Max))
+		case l.UsedPercent >= cfg.Limits.WarnPercent:
+			health.degrade("warning", fmt.Sprintf("%s at %.0f%% (%d/%d)", name, l.UsedPercent, l.Used, l.Max))
+		}
+	}
+}
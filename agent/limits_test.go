@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type fakeProcess struct {
+	uid    string
+	fds    map[string]string
+	fdinfo map[string]string
+}
+
+// fakeProcRoot builds a /proc tree with fd links, fdinfo and status files
+// and points procRoot at it.
+func fakeProcRoot(t *testing.T, procs map[int]fakeProcess) {
+	t.Helper()
+	root := t.TempDir()
+	for pid, proc := range procs {
+		dir := filepath.Join(root, strconv.Itoa(pid))
+		for _, sub := range []string{"fd", "fdinfo"} {
+			if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		status := "Name:\tfake\nUid:\t" + proc.uid + "\t" + proc.uid + "\t" + proc.uid + "\t" + proc.uid + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "status"), []byte(status), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for fd, target := range proc.fds {
+			if err := os.Symlink(target, filepath.Join(dir, "fd", fd)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for fd, info := range proc.fdinfo {
+			if err := os.WriteFile(filepath.Join(dir, "fdinfo", fd), []byte(info), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	saved := procRoot
+	t.Cleanup(func() { procRoot = saved })
+	procRoot = root
+}
+
+const inotifyFdinfo = "pos:\t0\nflags:\t02004000\nmnt_id:\t15\nino:\t1057\n" +
+	"inotify wd:2 ino:a2 sdev:800001 mask:fce ignored_mask:0 fhandle-bytes:8 fhandle-type:1 f_handle:a2000000ac3b8a7f\n" +
+	"inotify wd:1 ino:2 sdev:800001 mask:fce ignored_mask:0 fhandle-bytes:8 fhandle-type:1 f_handle:0200000000000000\n"
+
+func TestCountInotify(t *testing.T) {
+	fakeProcRoot(t, map[int]fakeProcess{
+		100: {
+			uid: "0",
+			fds: map[string]string{
+				"0": "/dev/null",
+				"3": "anon_inode:inotify",
+				"4": "socket:[5000]",
+				"5": "anon_inode:inotify",
+			},
+			fdinfo: map[string]string{"3": inotifyFdinfo, "5": "pos:\t0\nflags:\t02004000\n"},
+		},
+		200: {
+			uid:    "1000",
+			fds:    map[string]string{"7": "anon_inode:inotify"},
+			fdinfo: map[string]string{"7": inotifyFdinfo},
+		},
+		// An instance whose fdinfo went away still counts.
+		300: {
+			uid: "1000",
+			fds: map[string]string{"3": "anon_inode:inotify"},
+		},
+		400: {
+			uid: "1000",
+			fds: map[string]string{"3": "pipe:[42]", "4": "anon_inode:[eventpoll]"},
+		},
+	})
+
+	fds := scanProcessFDs([]procStat{{PID: 100}, {PID: 200}, {PID: 300}, {PID: 400}, {PID: 999}})
+	if len(fds) != 8 {
+		t.Fatalf("scanProcessFDs found %d descriptors, want 8: %+v", len(fds), fds)
+	}
+	watches, instances := countInotify(fds)
+	if want := map[string]uint64{"0": 2, "1000": 2}; !reflect.DeepEqual(watches, want) {
+		t.Errorf("watches = %v, want %v", watches, want)
+	}
+	if want := map[string]uint64{"0": 2, "1000": 2}; !reflect.DeepEqual(instances, want) {
+		t.Errorf("instances = %v, want %v", instances, want)
+	}
+}
+
+func TestBusiestUser(t *testing.T) {
+	tests := []struct {
+		counts map[string]uint64
+		uid    string
+		count  uint64
+	}{
+		{map[string]uint64{"0": 3, "1000": 12, "33": 1}, "1000", 12},
+		{map[string]uint64{"1000": 4, "0": 4}, "0", 4},
+		{map[string]uint64{"1000": 0}, "1000", 0},
+		{map[string]uint64{}, "", 0},
+		{nil, "", 0},
+	}
+	for _, tt := range tests {
+		uid, count := busiestUser(tt.counts)
+		if uid != tt.uid || count != tt.count {
+			t.Errorf("busiestUser(%v) = %q, %d, want %q, %d", tt.counts, uid, count, tt.uid, tt.count)
+		}
+	}
+}
+
+func TestParseFileNr(t *testing.T) {
+	tests := []struct {
+		value     string
+		used, max uint64
+		ok        bool
+	}{
+		{"7136\t0\t9223372036854775807\n", 7136, 9223372036854775807, true},
+		{"1920 128 808124", 1792, 808124, true},
+		{"1920 0", 0, 0, false},
+		{"", 0, 0, false},
+		{"a 0 808124", 0, 0, false},
+		{"10 20 808124", 0, 0, false},
+	}
+	for _, tt := range tests {
+		used, max, ok := parseFileNr(tt.value)
+		if used != tt.used || max != tt.max || ok != tt.ok {
+			t.Errorf("parseFileNr(%q) = %d, %d, %v, want %d, %d, %v", tt.value, used, max, ok, tt.used, tt.max, tt.ok)
+		}
+	}
+}
+
+func TestParseLoadavgThreads(t *testing.T) {
+	tests := []struct {
+		value   string
+		threads uint64
+		ok      bool
+	}{
+		{"0.52 0.58 0.59 3/1181 123456\n", 1181, true},
+		{"0.00 0.01 0.05 1/97 1", 97, true},
+		{"0.52 0.58 0.59", 0, false},
+		{"0.52 0.58 0.59 1181 123456", 0, false},
+		{"0.52 0.58 0.59 3/x 123456", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		threads, ok := parseLoadavgThreads(tt.value)
+		if threads != tt.threads || ok != tt.ok {
+			t.Errorf("parseLoadavgThreads(%q) = %d, %v, want %d, %v", tt.value, threads, ok, tt.threads, tt.ok)
+		}
+	}
+}
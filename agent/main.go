@@ -34,15 +34,33 @@ type metricsPayload struct {
 
 type extendedPayload struct {
 	metricsPayload
-	Meta      metaInfo      `json:"meta,omitempty"`
-	System    systemInfo    `json:"system,omitempty"`
-	CPU       cpuInfo       `json:"cpu,omitempty"`
-	Memory    memoryInfo    `json:"memory,omitempty"`
-	Disk      diskInfo      `json:"disk,omitempty"`
-	Network   networkInfo   `json:"network,omitempty"`
-	Processes processesInfo `json:"processes,omitempty"`
-	Health    healthInfo    `json:"health,omitempty"`
-	Time      timeInfo      `json:"time,omitempty"`
+	Meta         metaInfo                 `json:"meta,omitempty"`
+	System       systemInfo               `json:"system,omitempty"`
+	CPU          cpuInfo                  `json:"cpu,omitempty"`
+	Memory       memoryInfo               `json:"memory,omitempty"`
+	Disk         diskInfo                 `json:"disk,omitempty"`
+	Network      networkInfo              `json:"network,omitempty"`
+	Processes    processesInfo            `json:"processes,omitempty"`
+	Containers   []containerInfo          `json:"containers,omitempty"`
+	Services     []serviceInfo            `json:"services,omitempty"`
+	Systemd      *systemdInfo             `json:"systemd,omitempty"`
+	Sensors      *sensorsInfo             `json:"sensors,omitempty"`
+	Throttling   *throttlingInfo          `json:"throttling,omitempty"`
+	Smart        []smartDiskInfo          `json:"smart,omitempty"`
+	Storage      *storageInfo             `json:"storage,omitempty"`
+	Traffic      *trafficInfo             `json:"traffic,omitempty"`
+	Sockets      *socketsInfo             `json:"sockets,omitempty"`
+	Ports        []listeningPortInfo      `json:"ports,omitempty"`
+	Limits       []kernelLimitInfo        `json:"limits,omitempty"`
+	Wireguard    []wireguardInterfaceInfo `json:"wireguard,omitempty"`
+	Probes       []probeInfo              `json:"probes,omitempty"`
+	Certificates []certificateInfo        `json:"certificates,omitempty"`
+	Events       []eventInfo              `json:"events,omitempty"`
+	Health       healthInfo               `json:"health,omitempty"`
+	Time         timeInfo                 `json:"time,omitempty"`
+
+	// wireguardErr is why Wireguard is empty, for health.
+	wireguardErr error
 }
 
 type metaInfo struct {
@@ -111,8 +129,9 @@ type swapInfo struct {
 }
 
 type diskInfo struct {
-	Devices []diskDeviceInfo `json:"devices,omitempty"`
-	FS      []diskFSInfo     `json:"fs,omitempty"`
+	Devices  []diskDeviceInfo    `json:"devices,omitempty"`
+	FS       []diskFSInfo        `json:"fs,omitempty"`
+	Required []requiredMountInfo `json:"required,omitempty"`
 }
 
 type diskDeviceInfo struct {
@@ -127,39 +146,61 @@ type diskDeviceInfo struct {
 }
 
 type diskFSInfo struct {
-	Mount            string  `json:"mount,omitempty"`
-	FSType           string  `json:"fstype,omitempty"`
-	UsedPercent      float64 `json:"used_percent,omitempty"`
-	TotalGB          float64 `json:"total_gb,omitempty"`
-	FreeGB           float64 `json:"free_gb,omitempty"`
-	InodeUsedPercent float64 `json:"inode_used_percent,omitempty"`
-	Readonly         bool    `json:"readonly,omitempty"`
+	Mount            string   `json:"mount,omitempty"`
+	FSType           string   `json:"fstype,omitempty"`
+	UsedPercent      float64  `json:"used_percent,omitempty"`
+	TotalGB          float64  `json:"total_gb,omitempty"`
+	FreeGB           float64  `json:"free_gb,omitempty"`
+	InodeUsedPercent float64  `json:"inode_used_percent,omitempty"`
+	Readonly         bool     `json:"readonly,omitempty"`
+	Options          []string `json:"options,omitempty"`
+	SuperOptions     []string `json:"super_options,omitempty"`
+	Stale            bool     `json:"stale,omitempty"`
+	// GrowthBytesPerHour and the forecasts come from the usage history
+	// sampled in the background; they are empty until enough is recorded.
+	GrowthBytesPerHour   float64 `json:"growth_bytes_per_hour,omitempty"`
+	ForecastFullAt       string  `json:"forecast_full_at,omitempty"`
+	InodesForecastFullAt string  `json:"inodes_forecast_full_at,omitempty"`
 }
 
 type networkInfo struct {
 	Interfaces []networkInterfaceInfo `json:"interfaces,omitempty"`
+	Roles      []networkRoleInfo      `json:"roles,omitempty"`
 }
 
 type networkInterfaceInfo struct {
-	Name     string  `json:"name,omitempty"`
-	RxBps    int64   `json:"rx_bps,omitempty"`
-	TxBps    int64   `json:"tx_bps,omitempty"`
-	RxPps    float64 `json:"rx_pps,omitempty"`
-	TxPps    float64 `json:"tx_pps,omitempty"`
-	RxErrors uint64  `json:"rx_errors,omitempty"`
-	TxErrors uint64  `json:"tx_errors,omitempty"`
-	Dropped  uint64  `json:"dropped,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Type      string   `json:"type,omitempty"`
+	OperState string   `json:"operstate,omitempty"`
+	Carrier   *bool    `json:"carrier,omitempty"`
+	SpeedMbps int      `json:"speed_mbps,omitempty"`
+	Duplex    string   `json:"duplex,omitempty"`
+	MTU       int      `json:"mtu,omitempty"`
+	MAC       string   `json:"mac,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	RxBps     int64    `json:"rx_bps,omitempty"`
+	TxBps     int64    `json:"tx_bps,omitempty"`
+	RxPps     float64  `json:"rx_pps,omitempty"`
+	TxPps     float64  `json:"tx_pps,omitempty"`
+	RxErrors  uint64   `json:"rx_errors,omitempty"`
+	TxErrors  uint64   `json:"tx_errors,omitempty"`
+	Dropped   uint64   `json:"dropped,omitempty"`
 }
 
 type processesInfo struct {
-	Total   int `json:"total,omitempty"`
-	Zombies int `json:"zombies,omitempty"`
+	Total   int                  `json:"total,omitempty"`
+	Zombies int                  `json:"zombies,omitempty"`
+	Top     []processInfo        `json:"top,omitempty"`
+	Watched []watchedProcessInfo `json:"watched,omitempty"`
 }
 
 type healthInfo struct {
-	Status  string         `json:"status,omitempty"`
-	Reasons []string       `json:"reasons,omitempty"`
-	Scores  map[string]int `json:"scores,omitempty"`
+	Status            string                 `json:"status,omitempty"`
+	Reasons           []string               `json:"reasons,omitempty"`
+	Scores            map[string]int         `json:"scores,omitempty"`
+	Maintenance       bool                   `json:"maintenance,omitempty"`
+	MaintenanceWindow *maintenanceWindowInfo `json:"maintenance_window,omitempty"`
 }
 
 type timeInfo struct {
@@ -182,10 +223,29 @@ type cpuSample struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "maintenance" {
+		if err := runMaintenanceCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	addr := flag.String("addr", ":9100", "listen address")
 	token := flag.String("token", os.Getenv("STACKSCOPE_TOKEN"), "auth token")
+	configPath := flag.String("config", os.Getenv("STACKSCOPE_CONFIG"), "path to JSON config file")
 	flag.Parse()
 
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg = conf
+	loadMaintenanceState()
+	go runFSSampler()
+	go runTrafficAccounting()
+	runProbes()
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -238,6 +298,11 @@ func main() {
 		}
 	})
 
+	mux.HandleFunc("/maintenance", handleMaintenance(*token))
+	mux.HandleFunc("/traffic", handleTraffic(*token))
+	mux.HandleFunc("/ports", handlePorts(*token))
+	mux.HandleFunc("/probes", handleProbes(*token))
+
 	server := &http.Server{
 		Addr:              *addr,
 		Handler:           mux,
@@ -260,6 +325,16 @@ func authorized(r *http.Request, token string) bool {
 	return r.URL.Query().Get("token") == token
 }
 
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("encode response failed: %v", err)
+	}
+}
+
 func collectMetrics() (metricsPayload, error) {
 	cpuUsage, err := readCPUUsage(150 * time.Millisecond)
 	if err != nil {
@@ -342,7 +417,23 @@ func collectExtendedMetrics() (extendedPayload, error) {
 			"disk",
 			"network",
 			"processes",
+			"containers",
+			"services",
+			"systemd",
+			"sensors",
+			"throttling",
+			"smart",
+			"storage",
+			"traffic",
+			"sockets",
+			"ports",
+			"limits",
+			"wireguard",
+			"probes",
+			"certificates",
 			"health",
+			"maintenance",
+			"events",
 		},
 	}
 
@@ -352,15 +443,57 @@ func collectExtendedMetrics() (extendedPayload, error) {
 	memDetails, _ := readMemoryInfo()
 	diskDetails, _ := readDiskInfo()
 	networkDetails, _ := readNetworkInfo(200 * time.Millisecond)
-	processDetails, _ := readProcessInfo()
-	healthDetails := evaluateHealth(base, memDetails)
+	var processDetails processesInfo
+	procs, err := scanProcesses()
+	if err == nil {
+		processDetails = readProcessInfo(procs)
+	}
+	containerDetails, err := readContainers()
+	if err != nil {
+		log.Printf("read containers failed: %v", err)
+	}
+	serviceDetails, _ := readServices()
+	systemdDetails, err := readSystemd()
+	if err != nil {
+		log.Printf("read systemd units failed: %v", err)
+	}
+	sensorDetails, _ := readSensors()
+	throttlingDetails, err := readThrottling()
+	if err != nil {
+		log.Printf("read throttling state failed: %v", err)
+	}
+	smartDetails, _ := readSmart()
+	storageDetails, err := readStorage()
+	if err != nil {
+		log.Printf("read storage health failed: %v", err)
+	}
+
+	socketDetails, err := readSockets()
+	if err != nil {
+		log.Printf("read sockets failed: %v", err)
+	}
+
+	// Ports and kernel limits share one walk of the open descriptors.
+	var fds []procFD
+	if cfg.Ports.Enabled || cfg.Limits.Enabled {
+		fds = scanProcessFDs(procs)
+	}
+	portDetails, err := readPorts(fds)
+	if err != nil {
+		log.Printf("read ports failed: %v", err)
+	}
+
+	wireguardDetails, wireguardErr := readWireguard(time.Now())
+	if wireguardErr != nil {
+		log.Printf("read wireguard failed: %v", wireguardErr)
+	}
 
 	timeDetails := timeInfo{
 		CollectedAtUnix:    time.Now().UTC().Unix(),
 		AgentUptimeSeconds: base.UptimeSec,
 	}
 
-	return extendedPayload{
+	payload := extendedPayload{
 		metricsPayload: base,
 		Meta:           meta,
 		System:         system,
@@ -369,9 +502,28 @@ func collectExtendedMetrics() (extendedPayload, error) {
 		Disk:           diskDetails,
 		Network:        networkDetails,
 		Processes:      processDetails,
-		Health:         healthDetails,
+		Containers:     containerDetails,
+		Services:       serviceDetails,
+		Systemd:        systemdDetails,
+		Sensors:        sensorDetails,
+		Throttling:     throttlingDetails,
+		Smart:          smartDetails,
+		Storage:        storageDetails,
+		Traffic:        readTraffic(time.Now()),
+		Sockets:        socketDetails,
+		Ports:          portDetails,
+		Limits:         readLimits(fds),
+		Wireguard:      wireguardDetails,
+		wireguardErr:   wireguardErr,
+		Probes:         readProbes(false),
+		Certificates:   readCertificates(time.Now()),
+		Events:         readEvents(time.Now()),
 		Time:           timeDetails,
-	}, nil
+	}
+	payload.Health = evaluateHealth(payload)
+	applyMaintenance(&payload.Health, time.Now())
+
+	return payload, nil
 }
 
 func readCPUUsage(delay time.Duration) (float64, error) {
@@ -387,8 +539,8 @@ func readCPUUsage(delay time.Duration) (float64, error) {
 		return 0, err
 	}
 
-	total := float64(b.Total - a.Total)
-	idle := float64(b.Idle - a.Idle)
+	total := counterDiff(a.Total, b.Total)
+	idle := counterDiff(a.Idle, b.Idle)
 	if total <= 0 {
 		return 0, fmt.Errorf("cpu total diff <= 0")
 	}
@@ -520,6 +672,8 @@ func readSwapUsage() (float64, error) {
 	return used, nil
 }
 
+// readDiskUsage statfs's path directly rather than through the worker pool,
+// so slow mounts elsewhere cannot fail the root disk metric.
 func readDiskUsage(path string) (float64, error) {
 	var stat syscall.Statfs_t
 	if err := syscall.Statfs(path, &stat); err != nil {
@@ -539,33 +693,48 @@ func readDiskUsage(path string) (float64, error) {
 }
 
 func readDiskIO(interval time.Duration) (int64, int64, error) {
-	readA, writeA, err := readDiskStats()
+	before, err := readDiskStats()
 	if err != nil {
 		return 0, 0, err
 	}
 	time.Sleep(interval)
-	readB, writeB, err := readDiskStats()
+	after, err := readDiskStats()
 	if err != nil {
 		return 0, 0, err
 	}
-	readBps := int64(float64(readB-readA) / interval.Seconds())
-	writeBps := int64(float64(writeB-writeA) / interval.Seconds())
-	if readBps < 0 {
-		readBps = 0
-	}
-	if writeBps < 0 {
-		writeBps = 0
+	// Per device, so a device whose counters were reset during the sample
+	// is skipped instead of dropping the others.
+	var readBps, writeBps int64
+	for name, b := range after {
+		a, ok := before[name]
+		if !ok {
+			continue
+		}
+		// Sector counters wrap at 32 bits, not their byte equivalent.
+		readRate, readOK := calcRateInt64(a.readSectors, b.readSectors, interval.Seconds())
+		writeRate, writeOK := calcRateInt64(a.writeSectors, b.writeSectors, interval.Seconds())
+		if !readOK || !writeOK {
+			continue
+		}
+		readBps += readRate * 512
+		writeBps += writeRate * 512
 	}
 	return readBps, writeBps, nil
 }
 
-func readDiskStats() (uint64, uint64, error) {
+// diskCounters are raw 512-byte sector counts from /proc/diskstats.
+type diskCounters struct {
+	readSectors  uint64
+	writeSectors uint64
+}
+
+func readDiskStats() (map[string]diskCounters, error) {
 	data, err := os.ReadFile("/proc/diskstats")
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
-	var readBytes, writeBytes uint64
+	counters := make(map[string]diskCounters)
 	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
 		fields := strings.Fields(line)
@@ -578,16 +747,15 @@ func readDiskStats() (uint64, uint64, error) {
 		}
 		readSectors, err := strconv.ParseUint(fields[5], 10, 64)
 		if err != nil {
-			return 0, 0, err
+			return nil, err
 		}
 		writeSectors, err := strconv.ParseUint(fields[9], 10, 64)
 		if err != nil {
-			return 0, 0, err
+			return nil, err
 		}
-		readBytes += readSectors * 512
-		writeBytes += writeSectors * 512
+		counters[name] = diskCounters{readSectors: readSectors, writeSectors: writeSectors}
 	}
-	return readBytes, writeBytes, nil
+	return counters, nil
 }
 
 func isDiskDevice(name string) bool {
@@ -598,61 +766,52 @@ func isDiskDevice(name string) bool {
 }
 
 func readNetIO(interval time.Duration) (int64, int64, error) {
-	rxA, txA, err := readNetStats()
+	before, err := readNetStats()
 	if err != nil {
 		return 0, 0, err
 	}
 	time.Sleep(interval)
-	rxB, txB, err := readNetStats()
+	after, err := readNetStats()
 	if err != nil {
 		return 0, 0, err
 	}
-	rxBps := int64(float64(rxB-rxA) / interval.Seconds())
-	txBps := int64(float64(txB-txA) / interval.Seconds())
-	if rxBps < 0 {
-		rxBps = 0
-	}
-	if txBps < 0 {
-		txBps = 0
+	// Per interface, so an interface whose counters were reset during the
+	// sample, e.g. because it was recreated, is skipped instead of dropping
+	// the others.
+	var rxBps, txBps int64
+	for name, b := range after {
+		a, ok := before[name]
+		if !ok {
+			continue
+		}
+		rx, rxOK := calcRateInt64(a.RxBytes, b.RxBytes, interval.Seconds())
+		tx, txOK := calcRateInt64(a.TxBytes, b.TxBytes, interval.Seconds())
+		if !rxOK || !txOK {
+			continue
+		}
+		rxBps += rx
+		txBps += tx
 	}
 	return rxBps, txBps, nil
 }
 
-func readNetStats() (uint64, uint64, error) {
-	data, err := os.ReadFile("/proc/net/dev")
+// readNetStats returns the counters of the uplink interfaces.
+func readNetStats() (map[string]netSnapshot, error) {
+	stats, err := readNetSnapshotFile("/proc/net/dev")
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
-	lines := strings.Split(string(data), "\n")
-	var rxTotal, txTotal uint64
-	for _, line := range lines {
-		if !strings.Contains(line, ":") {
-			continue
-		}
-		parts := strings.Split(line, ":")
-		if len(parts) != 2 {
-			continue
-		}
-		iface := strings.TrimSpace(parts[0])
-		if iface == "lo" {
-			continue
-		}
-		fields := strings.Fields(parts[1])
-		if len(fields) < 16 {
-			continue
-		}
-		rx, err := strconv.ParseUint(fields[0], 10, 64)
-		if err != nil {
-			return 0, 0, err
-		}
-		tx, err := strconv.ParseUint(fields[8], 10, 64)
-		if err != nil {
-			return 0, 0, err
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	uplinks := uplinkInterfaces(names)
+	for name := range stats {
+		if !uplinks[name] {
+			delete(stats, name)
 		}
-		rxTotal += rx
-		txTotal += tx
 	}
-	return rxTotal, txTotal, nil
+	return stats, nil
 }
 
 func readLoadAvg() (float64, error) {
@@ -688,34 +847,18 @@ func readUptimeSeconds() (int64, error) {
 }
 
 func readFSUsage() ([]fsUsage, error) {
-	data, err := os.ReadFile("/proc/mounts")
+	mounts, err := readMounts()
 	if err != nil {
 		return nil, err
 	}
 
-	ignoreTypes := map[string]bool{
-		"proc": true, "sysfs": true, "devtmpfs": true, "tmpfs": true, "cgroup": true,
-		"cgroup2": true, "devpts": true, "overlay": true, "squashfs": true,
-		"rpc_pipefs": true, "fusectl": true, "autofs": true,
-	}
-
 	var result []fsUsage
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		fields := strings.Fields(line)
-		if len(fields) < 3 {
-			continue
-		}
-		mount := fields[1]
-		fsType := fields[2]
-		if ignoreTypes[fsType] {
-			continue
-		}
-		used, err := readDiskUsage(mount)
-		if err != nil {
+	for _, m := range statMounts(usableMounts(mounts)) {
+		if m.err != nil || m.stat.Blocks == 0 {
 			continue
 		}
-		result = append(result, fsUsage{Mount: mount, UsedPercent: used})
+		used := float64(m.stat.Blocks-m.stat.Bavail) / float64(m.stat.Blocks) * 100
+		result = append(result, fsUsage{Mount: m.Mount, UsedPercent: used})
 	}
 
 	if len(result) == 0 {
@@ -725,8 +868,8 @@ func readFSUsage() ([]fsUsage, error) {
 	sort.Slice(result, func(i, j int) bool {
 		return result[i].UsedPercent > result[j].UsedPercent
 	})
-	if len(result) > 3 {
-		result = result[:3]
+	if limit := cfg.Filesystems.FSUsageLimit; limit > 0 && len(result) > limit {
+		result = result[:limit]
 	}
 	return result, nil
 }
@@ -759,8 +902,9 @@ func readCPUExtended(delay time.Duration) (cpuInfo, error) {
 
 	totalUsage, perCore, iowait, steal := calcCPUUsage(before, after)
 	load, _ := readLoadAvgInfo()
-	ctxRate := calcRate(before.Ctxt, after.Ctxt, delay)
-	intrRate := calcRate(before.Intr, after.Intr, delay)
+	// These 64-bit counters only reset with a reboot; no rate is 0.
+	ctxRate, _ := calcRate(before.Ctxt, after.Ctxt, delay)
+	intrRate, _ := calcRate(before.Intr, after.Intr, delay)
 
 	return cpuInfo{
 		UsageTotalPercent:   totalUsage,
@@ -845,10 +989,10 @@ func calcCPUUsage(before, after cpuStatSnapshot) (float64, []float64, float64, f
 	if !ok {
 		return 0, nil, 0, 0
 	}
-	totalDiff := float64(totalAfter.Total - totalBefore.Total)
-	idleDiff := float64(totalAfter.Idle - totalBefore.Idle)
-	iowaitDiff := float64(totalAfter.IOWait - totalBefore.IOWait)
-	stealDiff := float64(totalAfter.Steal - totalBefore.Steal)
+	totalDiff := counterDiff(totalBefore.Total, totalAfter.Total)
+	idleDiff := counterDiff(totalBefore.Idle, totalAfter.Idle)
+	iowaitDiff := counterDiff(totalBefore.IOWait, totalAfter.IOWait)
+	stealDiff := counterDiff(totalBefore.Steal, totalAfter.Steal)
 
 	usage := percent(totalDiff-idleDiff, totalDiff)
 	iowait := percent(iowaitDiff, totalDiff)
@@ -863,8 +1007,8 @@ func calcCPUUsage(before, after cpuStatSnapshot) (float64, []float64, float64, f
 		if !ok {
 			continue
 		}
-		total := float64(afterTimes.Total - beforeTimes.Total)
-		idle := float64(afterTimes.Idle - beforeTimes.Idle)
+		total := counterDiff(beforeTimes.Total, afterTimes.Total)
+		idle := counterDiff(beforeTimes.Idle, afterTimes.Idle)
 		perCore = append(perCore, percent(total-idle, total))
 	}
 	sort.Float64s(perCore)
@@ -964,57 +1108,57 @@ func readDiskInfo() (diskInfo, error) {
 	if err != nil {
 		return diskInfo{}, err
 	}
+	trackReadonlyFlips(fs)
+	applyForecasts(fs, time.Now())
+	mounts, _ := readMounts()
 	return diskInfo{
-		Devices: []diskDeviceInfo{},
-		FS:      fs,
+		Devices:  []diskDeviceInfo{},
+		FS:       fs,
+		Required: readRequiredMounts(mounts),
 	}, nil
 }
 
 func readFSDetails() ([]diskFSInfo, error) {
-	data, err := os.ReadFile("/proc/mounts")
+	mounts, err := readMounts()
 	if err != nil {
 		return nil, err
 	}
 
-	ignoreTypes := map[string]bool{
-		"proc": true, "sysfs": true, "devtmpfs": true, "tmpfs": true, "cgroup": true,
-		"cgroup2": true, "devpts": true, "overlay": true, "squashfs": true,
-		"rpc_pipefs": true, "fusectl": true, "autofs": true,
-	}
-
 	var result []diskFSInfo
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		fields := strings.Fields(line)
-		if len(fields) < 4 {
+	for _, m := range statMounts(usableMounts(mounts)) {
+		// A mount that got no worker in time is as unresponsive as one
+		// whose statfs timed out.
+		if m.err == errStatfsTimeout || m.err == errStatfsBusy {
+			result = append(result, diskFSInfo{
+				Mount:        m.Mount,
+				FSType:       m.FSType,
+				Readonly:     m.readonly(),
+				Options:      m.Options,
+				SuperOptions: m.SuperOptions,
+				Stale:        true,
+			})
 			continue
 		}
-		mount := fields[1]
-		fsType := fields[2]
-		options := fields[3]
-		if ignoreTypes[fsType] {
-			continue
-		}
-
-		stat := syscall.Statfs_t{}
-		if err := syscall.Statfs(mount, &stat); err != nil {
+		if m.err != nil {
 			continue
 		}
+		stat := m.stat
 		totalBytes := float64(stat.Blocks) * float64(stat.Bsize)
 		freeBytes := float64(stat.Bavail) * float64(stat.Bsize)
 		usedBytes := totalBytes - freeBytes
 		usedPercent := percent(usedBytes, totalBytes)
 		inodeUsed := float64(stat.Files-stat.Ffree) / float64(max(stat.Files, 1)) * 100
-		readonly := strings.Contains(options, "ro")
 
 		result = append(result, diskFSInfo{
-			Mount:            mount,
-			FSType:           fsType,
+			Mount:            m.Mount,
+			FSType:           m.FSType,
 			UsedPercent:      usedPercent,
 			TotalGB:          totalBytes / (1024.0 * 1024.0 * 1024.0),
 			FreeGB:           freeBytes / (1024.0 * 1024.0 * 1024.0),
 			InodeUsedPercent: inodeUsed,
-			Readonly:         readonly,
+			Readonly:         m.readonly(),
+			Options:          m.Options,
+			SuperOptions:     m.SuperOptions,
 		})
 	}
 
@@ -1054,21 +1198,32 @@ func readNetworkInfo(delay time.Duration) (networkInfo, error) {
 		if !ok {
 			continue
 		}
+		// A counter reset yields no rate, which omitempty leaves out.
 		interval := delay.Seconds()
-		rxBps := calcRateInt64(beforeStats.RxBytes, afterStats.RxBytes, interval)
-		txBps := calcRateInt64(beforeStats.TxBytes, afterStats.TxBytes, interval)
-		rxPps := calcRateFloat(beforeStats.RxPackets, afterStats.RxPackets, interval)
-		txPps := calcRateFloat(beforeStats.TxPackets, afterStats.TxPackets, interval)
+		rxBps, _ := calcRateInt64(beforeStats.RxBytes, afterStats.RxBytes, interval)
+		txBps, _ := calcRateInt64(beforeStats.TxBytes, afterStats.TxBytes, interval)
+		rxPps, _ := calcRateFloat(beforeStats.RxPackets, afterStats.RxPackets, interval)
+		txPps, _ := calcRateFloat(beforeStats.TxPackets, afterStats.TxPackets, interval)
 
+		meta := readInterfaceMeta(name)
 		interfaces = append(interfaces, networkInterfaceInfo{
-			Name:     name,
-			RxBps:    rxBps,
-			TxBps:    txBps,
-			RxPps:    rxPps,
-			TxPps:    txPps,
-			RxErrors: afterStats.RxErrors,
-			TxErrors: afterStats.TxErrors,
-			Dropped:  afterStats.Dropped,
+			Name:      name,
+			Type:      meta.Type,
+			OperState: meta.OperState,
+			Carrier:   meta.Carrier,
+			SpeedMbps: meta.SpeedMbps,
+			Duplex:    meta.Duplex,
+			MTU:       meta.MTU,
+			MAC:       meta.MAC,
+			Addresses: meta.Addresses,
+			Roles:     interfaceRoles(name),
+			RxBps:     rxBps,
+			TxBps:     txBps,
+			RxPps:     rxPps,
+			TxPps:     txPps,
+			RxErrors:  afterStats.RxErrors,
+			TxErrors:  afterStats.TxErrors,
+			Dropped:   afterStats.Dropped,
 		})
 	}
 
@@ -1076,11 +1231,24 @@ func readNetworkInfo(delay time.Duration) (networkInfo, error) {
 		return interfaces[i].Name < interfaces[j].Name
 	})
 
-	return networkInfo{Interfaces: interfaces}, nil
+	return networkInfo{Interfaces: interfaces, Roles: roleTotals(interfaces)}, nil
 }
 
 func readNetSnapshot() (map[string]netSnapshot, error) {
-	data, err := os.ReadFile("/proc/net/dev")
+	stats, err := readNetSnapshotFile("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	for name := range stats {
+		if !interfaceSelected(name) {
+			delete(stats, name)
+		}
+	}
+	return stats, nil
+}
+
+func readNetSnapshotFile(path string) (map[string]netSnapshot, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -1122,39 +1290,35 @@ func readNetSnapshot() (map[string]netSnapshot, error) {
 	return stats, nil
 }
 
-func readProcessInfo() (processesInfo, error) {
-	entries, err := os.ReadDir("/proc")
-	if err != nil {
-		return processesInfo{}, err
-	}
-	total := 0
+func readProcessInfo(procs []procStat) processesInfo {
 	zombies := 0
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		if _, err := strconv.Atoi(entry.Name()); err != nil {
-			continue
-		}
-		total++
-		state, err := readProcessState(entry.Name())
-		if err == nil && state == "Z" {
+	for _, proc := range procs {
+		if proc.State == "Z" {
 			zombies++
 		}
 	}
-	return processesInfo{Total: total, Zombies: zombies}, nil
+	now := time.Now()
+	measured := measureProcesses(procs, now)
+	return processesInfo{
+		Total:   len(procs),
+		Zombies: zombies,
+		Top:     topProcesses(procs, measured, now),
+		Watched: watchProcesses(procs, measured, now),
+	}
 }
 
-func readProcessState(pid string) (string, error) {
-	data, err := os.ReadFile("/proc/" + pid + "/stat")
+// readProcessStartTime converts the starttime field of /proc/<pid>/stat
+// (clock ticks since boot) to wall-clock time.
+func readProcessStartTime(pid string) (time.Time, error) {
+	stat, err := readProcStat(pid)
 	if err != nil {
-		return "", err
+		return time.Time{}, err
 	}
-	fields := strings.Fields(string(data))
-	if len(fields) < 3 {
-		return "", fmt.Errorf("unexpected /proc/%s/stat format", pid)
+	boot, err := time.Parse(time.RFC3339, readBootTime())
+	if err != nil {
+		return time.Time{}, err
 	}
-	return fields[2], nil
+	return stat.startTime(boot), nil
 }
 
 func readSystemInfo() systemInfo {
@@ -1240,55 +1404,81 @@ func readBootTime() string {
 	return ""
 }
 
-func evaluateHealth(base metricsPayload, mem memoryInfo) healthInfo {
-	status := "ok"
-	reasons := []string{}
-	scores := map[string]int{}
+func evaluateHealth(payload extendedPayload) healthInfo {
+	base := payload.metricsPayload
+	health := healthInfo{Status: "ok", Reasons: []string{}, Scores: map[string]int{}}
 
 	if base.DiskUsage >= 90 {
-		status = "warning"
-		reasons = append(reasons, "disk usage >= 90%")
+		health.degrade("warning", "disk usage >= 90%")
 	} else if base.DiskUsage >= 80 {
-		status = "warning"
-		reasons = append(reasons, "disk usage >= 80%")
+		health.degrade("warning", "disk usage >= 80%")
 	}
 
 	if base.MemoryUsage >= 90 {
-		status = "warning"
-		reasons = append(reasons, "memory usage >= 90%")
+		health.degrade("warning", "memory usage >= 90%")
 	} else if base.MemoryUsage >= 80 {
-		status = "warning"
-		reasons = append(reasons, "memory usage >= 80%")
+		health.degrade("warning", "memory usage >= 80%")
 	}
 
-	scores["cpu"] = int(base.CPUUsage)
-	scores["memory"] = int(base.MemoryUsage)
-	scores["disk"] = int(base.DiskUsage)
-	scores["network"] = 0
+	health.Scores["cpu"] = int(base.CPUUsage)
+	health.Scores["memory"] = int(base.MemoryUsage)
+	health.Scores["disk"] = int(base.DiskUsage)
+	health.Scores["network"] = 0
+
+	evaluateFilesystemHealth(&health, payload.Disk)
+	evaluateForecastHealth(&health, payload.Disk.FS, time.Now())
+	evaluateContainersHealth(&health, payload.Containers)
+	evaluateSystemdHealth(&health, payload.Systemd)
+	evaluateWatchdogHealth(&health, payload.Processes.Watched)
+	evaluateSensorsHealth(&health, payload.Sensors)
+	evaluateThrottlingHealth(&health, payload.Throttling)
+	evaluateSmartHealth(&health, payload.Smart)
+	evaluateStorageHealth(&health, payload.Storage)
+	evaluateTrafficHealth(&health, payload.Traffic)
+	evaluateLimitsHealth(&health, payload.Limits)
+	evaluateWireguardHealth(&health, payload.Wireguard, payload.wireguardErr)
+	evaluateProbesHealth(&health, payload.Probes)
+	evaluateCertificatesHealth(&health, payload.Certificates)
+	evaluateEventsHealth(&health, payload.Events, time.Now())
 
-	return healthInfo{Status: status, Reasons: reasons, Scores: scores}
+	return health
 }
 
-func calcRate(before, after uint64, delay time.Duration) float64 {
-	interval := delay.Seconds()
-	if interval <= 0 {
-		return 0
+var healthLevels = map[string]int{"ok": 0, "warning": 1, "critical": 2}
+
+// degrade records a reason and raises the status to at least the given level.
+func (h *healthInfo) degrade(status, reason string) {
+	if healthLevels[status] > healthLevels[h.Status] {
+		h.Status = status
 	}
-	return float64(after-before) / interval
+	h.Reasons = append(h.Reasons, reason)
 }
 
-func calcRateInt64(before, after uint64, interval float64) int64 {
-	if interval <= 0 {
-		return 0
-	}
-	return int64(float64(after-before) / interval)
+// The calcRate helpers return ok false, and a rate of 0, for a sample that
+// spans a counter reset or has no interval. calcRate is for 64-bit
+// counters; calcRateInt64 and calcRateFloat are for network and disk
+// counters, which may be 32 bits wide and wrap.
+func calcRate(before, after uint64, delay time.Duration) (float64, bool) {
+	return counterRate(before, after, delay.Seconds())
+}
+
+func calcRateInt64(before, after uint64, interval float64) (int64, bool) {
+	rate, ok := counter32Rate(before, after, interval)
+	return int64(rate), ok
+}
+
+func calcRateFloat(before, after uint64, interval float64) (float64, bool) {
+	return counter32Rate(before, after, interval)
 }
 
-func calcRateFloat(before, after uint64, interval float64) float64 {
-	if interval <= 0 {
+// counterDiff is the growth of a CPU time counter in jiffies, clamped at 0.
+// iowait and steal can go backwards on some kernels, which is neither a
+// wrap nor a reset.
+func counterDiff(before, after uint64) float64 {
+	if after < before {
 		return 0
 	}
-	return float64(after-before) / interval
+	return float64(after - before)
 }
 
 func percent(part, total float64) float64 {
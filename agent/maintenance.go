@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maintenanceStateFile = "maintenance.json"
+
+type maintenanceConfig struct {
+	Windows []maintenanceSchedule `json:"windows"`
+}
+
+// maintenanceSchedule is a recurring window, e.g. every Sunday at 03:00 for 1h.
+// An empty Days list means every day.
+type maintenanceSchedule struct {
+	Name     string   `json:"name"`
+	Days     []string `json:"days"`
+	Start    string   `json:"start"`
+	Duration duration `json:"duration"`
+	Timezone string   `json:"timezone"`
+}
+
+type maintenanceWindowInfo struct {
+	Source    string `json:"source"`
+	Name      string `json:"name,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	StartedAt string `json:"started_at"`
+	EndsAt    string `json:"ends_at"`
+}
+
+type maintenanceStatus struct {
+	Active bool                   `json:"active"`
+	Window *maintenanceWindowInfo `json:"window,omitempty"`
+}
+
+type manualMaintenance struct {
+	Reason    string    `json:"reason,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	EndsAt    time.Time `json:"ends_at"`
+}
+
+type maintenanceState struct {
+	mu     sync.Mutex
+	manual *manualMaintenance
+}
+
+var maintenance = &maintenanceState{}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func (s maintenanceSchedule) validate() error {
+	if _, _, err := parseClock(s.Start); err != nil {
+		return err
+	}
+	if s.Duration.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return err
+	}
+	for _, day := range s.Days {
+		if _, ok := parseWeekday(day); !ok {
+			return fmt.Errorf("unknown day %q", day)
+		}
+	}
+	return nil
+}
+
+// activeAt reports the occurrence of the schedule covering now, if any.
+func (s maintenanceSchedule) activeAt(now time.Time) (time.Time, time.Time, bool) {
+	hour, minute, err := parseClock(s.Start)
+	if err != nil || s.Duration.Duration <= 0 {
+		return time.Time{}, time.Time{}, false
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	local := now.In(loc)
+	lookback := int(s.Duration.Duration/(24*time.Hour)) + 1
+	for i := 0; i <= lookback; i++ {
+		day := local.AddDate(0, 0, -i)
+		start := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+		if !s.onDay(start.Weekday()) {
+			continue
+		}
+		end := start.Add(s.Duration.Duration)
+		if !now.Before(start) && now.Before(end) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+func (s maintenanceSchedule) onDay(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, name := range s.Days {
+		if d, ok := parseWeekday(name); ok && d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) < 3 {
+		return 0, false
+	}
+	day, ok := weekdays[name[:3]]
+	return day, ok
+}
+
+func parseClock(value string) (int, int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start %q, expected HH:MM", value)
+	}
+	return parsed.Hour(), parsed.Minute(), nil
+}
+
+func loadMaintenanceState() {
+	var manual manualMaintenance
+	if err := readState(maintenanceStateFile, &manual); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("load maintenance state failed: %v", err)
+		}
+		return
+	}
+	if time.Now().Before(manual.EndsAt) {
+		maintenance.mu.Lock()
+		maintenance.manual = &manual
+		maintenance.mu.Unlock()
+	}
+}
+
+func (m *maintenanceState) start(length time.Duration, reason string, now time.Time) maintenanceStatus {
+	manual := &manualMaintenance{
+		Reason:    reason,
+		StartedAt: now.UTC(),
+		EndsAt:    now.Add(length).UTC(),
+	}
+
+	m.mu.Lock()
+	m.manual = manual
+	m.mu.Unlock()
+
+	if err := writeState(maintenanceStateFile, manual); err != nil {
+		log.Printf("persist maintenance state failed: %v", err)
+	}
+	return m.status(now)
+}
+
+func (m *maintenanceState) stop(now time.Time) maintenanceStatus {
+	m.mu.Lock()
+	m.manual = nil
+	m.mu.Unlock()
+
+	if err := removeState(maintenanceStateFile); err != nil {
+		log.Printf("clear maintenance state failed: %v", err)
+	}
+	return m.status(now)
+}
+
+// status returns the window in effect at now. A manual window wins over
+// scheduled ones so its reason is what gets reported.
+func (m *maintenanceState) status(now time.Time) maintenanceStatus {
+	m.mu.Lock()
+	manual := m.manual
+	if manual != nil && !now.Before(manual.EndsAt) {
+		m.manual = nil
+		manual = nil
+	}
+	m.mu.Unlock()
+
+	if manual != nil {
+		return maintenanceStatus{
+			Active: true,
+			Window: &maintenanceWindowInfo{
+				Source:    "manual",
+				Reason:    manual.Reason,
+				StartedAt: manual.StartedAt.Format(time.RFC3339),
+				EndsAt:    manual.EndsAt.Format(time.RFC3339),
+			},
+		}
+	}
+
+	for _, schedule := range cfg.Maintenance.Windows {
+		start, end, ok := schedule.activeAt(now)
+		if !ok {
+			continue
+		}
+		return maintenanceStatus{
+			Active: true,
+			Window: &maintenanceWindowInfo{
+				Source:    "schedule",
+				Name:      schedule.Name,
+				StartedAt: start.UTC().Format(time.RFC3339),
+				EndsAt:    end.UTC().Format(time.RFC3339),
+			},
+		}
+	}
+	return maintenanceStatus{}
+}
+
+func applyMaintenance(health *healthInfo, now time.Time) {
+	status := maintenance.status(now)
+	health.Maintenance = status.Active
+	health.MaintenanceWindow = status.Window
+}
+
+type maintenanceRequest struct {
+	Duration duration `json:"duration"`
+	Reason   string   `json:"reason"`
+}
+
+func handleMaintenance(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, maintenance.status(time.Now()))
+		case http.MethodPost:
+			req, err := parseMaintenanceRequest(r)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(err.Error()))
+				return
+			}
+			log.Printf("maintenance started for %s: %s", req.Duration.Duration, req.Reason)
+			writeJSON(w, http.StatusOK, maintenance.start(req.Duration.Duration, req.Reason, time.Now()))
+		case http.MethodDelete:
+			log.Printf("maintenance stopped")
+			writeJSON(w, http.StatusOK, maintenance.stop(time.Now()))
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func parseMaintenanceRequest(r *http.Request) (maintenanceRequest, error) {
+	var req maintenanceRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+			return req, fmt.Errorf("invalid body: %v", err)
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return req, err
+		}
+		if value := r.Form.Get("duration"); value != "" {
+			parsed, err := parseDuration(value)
+			if err != nil {
+				return req, fmt.Errorf("invalid duration: %v", err)
+			}
+			req.Duration.Duration = parsed
+		}
+		req.Reason = r.Form.Get("reason")
+	}
+	if req.Duration.Duration <= 0 {
+		return req, fmt.Errorf("duration must be positive")
+	}
+	return req, nil
+}
+
+// runMaintenanceCommand implements `stackscope-agent maintenance <start|stop|status>`
+// by calling the /maintenance endpoint of a running agent.
+func runMaintenanceCommand(args []string) error {
+	fs := flag.NewFlagSet("maintenance", flag.ExitOnError)
+	agent := fs.String("agent", "http://127.0.0.1:9100", "agent base URL")
+	token := fs.String("token", os.Getenv("STACKSCOPE_TOKEN"), "auth token")
+	length := fs.Duration("duration", time.Hour, "maintenance window length")
+	reason := fs.String("reason", "", "reason shown in the web app")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: stackscope-agent maintenance <start|stop|status> [flags]")
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing action")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var method string
+	var body io.Reader
+	switch action {
+	case "start":
+		method = http.MethodPost
+		data, err := json.Marshal(maintenanceRequest{Duration: duration{*length}, Reason: *reason})
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	case "stop":
+		method = http.MethodDelete
+	case "status":
+		method = http.MethodGet
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown action %q", action)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(*agent, "/")+"/maintenance", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if *token != "" {
+		req.Header.Set("X-Stackscope-Token", *token)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("agent returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
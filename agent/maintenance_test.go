@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceScheduleActiveAt(t *testing.T) {
+	nightly := maintenanceSchedule{Start: "23:30", Duration: duration{2 * time.Hour}, Timezone: "UTC"}
+	sunday := maintenanceSchedule{Days: []string{"sun"}, Start: "03:00", Duration: duration{time.Hour}, Timezone: "UTC"}
+	saturdayNight := maintenanceSchedule{Days: []string{"Saturday"}, Start: "22:00", Duration: duration{4 * time.Hour}, Timezone: "UTC"}
+	berlin := maintenanceSchedule{Days: []string{"mon"}, Start: "01:00", Duration: duration{time.Hour}, Timezone: "Europe/Berlin"}
+
+	// 2024-06-02 is a Sunday.
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	tests := []struct {
+		name      string
+		schedule  maintenanceSchedule
+		now       string
+		active    bool
+		wantStart string
+	}{
+		{"before a daily window", nightly, "2024-06-02T23:29:59Z", false, ""},
+		{"daily window start", nightly, "2024-06-02T23:30:00Z", true, "2024-06-02T23:30:00Z"},
+		{"daily window after midnight", nightly, "2024-06-03T01:00:00Z", true, "2024-06-02T23:30:00Z"},
+		{"daily window end is exclusive", nightly, "2024-06-03T01:30:00Z", false, ""},
+		{"on the scheduled day", sunday, "2024-06-02T03:30:00Z", true, "2024-06-02T03:00:00Z"},
+		{"same time on another day", sunday, "2024-06-03T03:30:00Z", false, ""},
+		{"spills past midnight into sunday", saturdayNight, "2024-06-02T01:59:00Z", true, "2024-06-01T22:00:00Z"},
+		{"does not start on sunday night", saturdayNight, "2024-06-02T23:00:00Z", false, ""},
+		{"monday in Berlin is sunday in UTC", berlin, "2024-06-02T23:30:00Z", true, "2024-06-02T23:00:00Z"},
+		{"sunday in Berlin", berlin, "2024-06-01T23:30:00Z", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, active := tt.schedule.activeAt(at(tt.now))
+			if active != tt.active {
+				t.Fatalf("active = %v, want %v", active, tt.active)
+			}
+			if !active {
+				return
+			}
+			if !start.Equal(at(tt.wantStart)) {
+				t.Errorf("start = %s, want %s", start.UTC().Format(time.RFC3339), tt.wantStart)
+			}
+			if got := end.Sub(start); got != tt.schedule.Duration.Duration {
+				t.Errorf("window length = %s, want %s", got, tt.schedule.Duration.Duration)
+			}
+		})
+	}
+}
+
+func TestMaintenanceScheduleOnDay(t *testing.T) {
+	tests := []struct {
+		days []string
+		day  time.Weekday
+		want bool
+	}{
+		{nil, time.Wednesday, true},
+		{[]string{"mon", "fri"}, time.Friday, true},
+		{[]string{"mon", "fri"}, time.Saturday, false},
+		{[]string{"Sunday"}, time.Sunday, true},
+		{[]string{" TUE "}, time.Tuesday, true},
+		{[]string{"su"}, time.Sunday, false},
+	}
+	for _, tt := range tests {
+		if got := (maintenanceSchedule{Days: tt.days}).onDay(tt.day); got != tt.want {
+			t.Errorf("onDay(%v, %s) = %v, want %v", tt.days, tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceStatus(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+	cfg.Maintenance.Windows = []maintenanceSchedule{
+		{Name: "patching", Days: []string{"sun"}, Start: "03:00", Duration: duration{time.Hour}, Timezone: "UTC"},
+	}
+
+	inWindow := time.Date(2024, 6, 2, 3, 15, 0, 0, time.UTC)
+	state := &maintenanceState{}
+	status := state.status(inWindow)
+	if !status.Active || status.Window.Source != "schedule" || status.Window.Name != "patching" {
+		t.Fatalf("scheduled status = %+v", status.Window)
+	}
+	if status.Window.StartedAt != "2024-06-02T03:00:00Z" || status.Window.EndsAt != "2024-06-02T04:00:00Z" {
+		t.Errorf("scheduled window = %+v", status.Window)
+	}
+
+	// A manual window overrides the schedule while it lasts.
+	state.manual = &manualMaintenance{
+		Reason:    "kernel upgrade",
+		StartedAt: inWindow.Add(-5 * time.Minute),
+		EndsAt:    inWindow.Add(10 * time.Minute),
+	}
+	status = state.status(inWindow)
+	if !status.Active || status.Window.Source != "manual" || status.Window.Reason != "kernel upgrade" {
+		t.Errorf("manual status = %+v", status.Window)
+	}
+
+	// Once it ends the schedule shows through again and the manual window is dropped.
+	status = state.status(inWindow.Add(10 * time.Minute))
+	if !status.Active || status.Window.Source != "schedule" {
+		t.Errorf("status after manual window = %+v", status.Window)
+	}
+	if state.manual != nil {
+		t.Error("expired manual window was kept")
+	}
+
+	if status := state.status(inWindow.Add(time.Hour)); status.Active {
+		t.Errorf("status outside every window = %+v", status.Window)
+	}
+}
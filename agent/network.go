@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var netClassRoot = "/sys/class/net"
+
+type networkConfig struct {
+	// An interface is reported when it matches Include (or Include is
+	// empty) and does not match Exclude.
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// Roles tags interfaces by glob, e.g. {"wan": ["eth0"], "vpn": ["wg*"]}.
+	Roles map[string][]string `json:"roles"`
+}
+
+type networkRoleInfo struct {
+	Role       string   `json:"role"`
+	Interfaces []string `json:"interfaces"`
+	RxBps      int64    `json:"rx_bps"`
+	TxBps      int64    `json:"tx_bps"`
+	RxPps      float64  `json:"rx_pps"`
+	TxPps      float64  `json:"tx_pps"`
+}
+
+func (c networkConfig) validate() error {
+	patterns := append(append([]string(nil), c.Include...), c.Exclude...)
+	for _, globs := range c.Roles {
+		patterns = append(patterns, globs...)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+func interfaceSelected(name string) bool {
+	if len(cfg.Network.Include) > 0 && !matchAnyGlob(cfg.Network.Include, name) {
+		return false
+	}
+	return !matchAnyGlob(cfg.Network.Exclude, name)
+}
+
+// interfaceRoles returns every configured role whose globs match name.
+func interfaceRoles(name string) []string {
+	var roles []string
+	for role, globs := range cfg.Network.Roles {
+		if matchAnyGlob(globs, name) {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// roleTotals sums interface rates per role.
+func roleTotals(interfaces []networkInterfaceInfo) []networkRoleInfo {
+	byRole := map[string]*networkRoleInfo{}
+	for _, iface := range interfaces {
+		for _, role := range iface.Roles {
+			total := byRole[role]
+			if total == nil {
+				total = &networkRoleInfo{Role: role, Interfaces: []string{}}
+				byRole[role] = total
+			}
+			total.Interfaces = append(total.Interfaces, iface.Name)
+			total.RxBps += iface.RxBps
+			total.TxBps += iface.TxBps
+			total.RxPps += iface.RxPps
+			total.TxPps += iface.TxPps
+		}
+	}
+	result := make([]networkRoleInfo, 0, len(byRole))
+	for _, total := range byRole {
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Role < result[j].Role
+	})
+	return result
+}
+
+// interfaceMeta is what /sys/class/net and the kernel address list tell
+// about an interface besides its counters.
+type interfaceMeta struct {
+	Type      string
+	OperState string
+	Carrier   *bool
+	SpeedMbps int
+	Duplex    string
+	MTU       int
+	MAC       string
+	Addresses []string
+}
+
+// devTypes maps DEVTYPE from an interface's uevent to its reported type.
+var devTypes = map[string]string{
+	"bridge":    "bridge",
+	"bond":      "bond",
+	"vlan":      "vlan",
+	"macvlan":   "macvlan",
+	"macvtap":   "macvlan",
+	"ipvlan":    "ipvlan",
+	"ipvtap":    "ipvlan",
+	"wireguard": "wireguard",
+	"wlan":      "physical",
+}
+
+// interfaceTypes caches classifyInterface by name and ifindex; an index is
+// only reused once the interface is gone.
+var (
+	interfaceTypesMu sync.Mutex
+	interfaceTypes   = map[string]string{}
+)
+
+// classifyInterface returns physical, bridge, veth, vlan, macvlan, ipvlan,
+// bond, wireguard, tun, loopback or virtual.
+func classifyInterface(name string) string {
+	key := name + "/" + readSysfsString(filepath.Join(netClassRoot, name, "ifindex"))
+	interfaceTypesMu.Lock()
+	defer interfaceTypesMu.Unlock()
+	if kind, ok := interfaceTypes[key]; ok {
+		return kind
+	}
+	// Containers churn through veths; start over rather than grow forever.
+	if len(interfaceTypes) >= 1024 {
+		interfaceTypes = map[string]string{}
+	}
+	kind := detectInterfaceType(name)
+	interfaceTypes[key] = kind
+	return kind
+}
+
+func detectInterfaceType(name string) string {
+	dir := filepath.Join(netClassRoot, name)
+	linkType := readSysfsString(filepath.Join(dir, "type"))
+	if name == "lo" || linkType == "772" {
+		return "loopback"
+	}
+	for _, line := range strings.Split(readSysfsString(filepath.Join(dir, "uevent")), "\n") {
+		if devType, ok := strings.CutPrefix(line, "DEVTYPE="); ok {
+			if kind, known := devTypes[devType]; known {
+				return kind
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tun_flags")); err == nil {
+		return "tun"
+	}
+	// Only hardware NICs have a parent device; virtual ones live under
+	// /sys/devices/virtual.
+	if _, err := os.Stat(filepath.Join(dir, "device")); err == nil {
+		return "physical"
+	}
+	if strings.HasPrefix(name, "veth") {
+		return "veth"
+	}
+	// Stacked devices (macvlan, ipvlan, vlan) link to their parent with
+	// lower_<name>; they also have iflink != ifindex but are not veths.
+	if lower, _ := filepath.Glob(filepath.Join(dir, "lower_*")); len(lower) > 0 {
+		return "virtual"
+	}
+	// What is left with iflink != ifindex is a veth whose peer sits in
+	// another namespace, or a tunnel bound to an underlying device; tunnels
+	// are not Ethernet (ARPHRD_ETHER).
+	iflink := readSysfsString(filepath.Join(dir, "iflink"))
+	if linkType == "1" && iflink != "" && iflink != "0" && iflink != readSysfsString(filepath.Join(dir, "ifindex")) {
+		return "veth"
+	}
+	return "virtual"
+}
+
+func readInterfaceMeta(name string) interfaceMeta {
+	dir := filepath.Join(netClassRoot, name)
+	meta := interfaceMeta{
+		Type:      classifyInterface(name),
+		OperState: readSysfsString(filepath.Join(dir, "operstate")),
+		Duplex:    readSysfsString(filepath.Join(dir, "duplex")),
+		MAC:       readSysfsString(filepath.Join(dir, "address")),
+	}
+	// carrier and speed cannot be read while the interface is down.
+	switch readSysfsString(filepath.Join(dir, "carrier")) {
+	case "1":
+		carrier := true
+		meta.Carrier = &carrier
+	case "0":
+		carrier := false
+		meta.Carrier = &carrier
+	}
+	if speed, err := strconv.Atoi(readSysfsString(filepath.Join(dir, "speed"))); err == nil && speed > 0 {
+		meta.SpeedMbps = speed
+	}
+	meta.MTU, _ = strconv.Atoi(readSysfsString(filepath.Join(dir, "mtu")))
+	if meta.Duplex == "unknown" {
+		meta.Duplex = ""
+	}
+
+	if iface, err := net.InterfaceByName(name); err == nil {
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				meta.Addresses = append(meta.Addresses, addr.String())
+			}
+		}
+	}
+	return meta
+}
+
+// uplinkInterfaces picks the interfaces whose traffic makes up the host's
+// net_rx_bps/net_tx_bps. With an explicit include list that is every
+// selected interface. Otherwise it is physical NICs only, so bridge, veth
+// and VLAN traffic that also crosses a NIC is not counted twice; inside a
+// container there are no physical NICs and every non-loopback interface is
+// used.
+func uplinkInterfaces(names []string) map[string]bool {
+	uplinks := map[string]bool{}
+	var fallback []string
+	for _, name := range names {
+		if !interfaceSelected(name) {
+			continue
+		}
+		if len(cfg.Network.Include) > 0 {
+			uplinks[name] = true
+			continue
+		}
+		switch classifyInterface(name) {
+		case "physical":
+			uplinks[name] = true
+		case "loopback":
+		default:
+			fallback = append(fallback, name)
+		}
+	}
+	if len(uplinks) == 0 {
+		for _, name := range fallback {
+			uplinks[name] = true
+		}
+	}
+	return uplinks
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeNetClass builds a /sys/class/net tree; files maps a path below the
+// interface directory to its content, and a value of "->" makes a symlink.
+func fakeNetClass(t *testing.T, interfaces map[string]map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, files := range interfaces {
+		for file, content := range files {
+			path := filepath.Join(root, name, file)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			var err error
+			if content == "->" {
+				err = os.Symlink(root, path)
+			} else {
+				err = os.WriteFile(path, []byte(content+"\n"), 0o644)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func useNetClassRoot(t *testing.T, root string) {
+	saved := netClassRoot
+	t.Cleanup(func() {
+		netClassRoot = saved
+		interfaceTypes = map[string]string{}
+	})
+	netClassRoot = root
+	interfaceTypes = map[string]string{}
+}
+
+func TestClassifyInterface(t *testing.T) {
+	root := fakeNetClass(t, map[string]map[string]string{
+		"lo":     {"type": "772", "ifindex": "1", "iflink": "1"},
+		"eth0":   {"type": "1", "ifindex": "2", "iflink": "2", "device": "->"},
+		"wlan0":  {"type": "1", "ifindex": "3", "iflink": "3", "uevent": "DEVTYPE=wlan\nINTERFACE=wlan0", "device": "->"},
+		"br0":    {"type": "1", "ifindex": "4", "iflink": "4", "uevent": "DEVTYPE=bridge\nINTERFACE=br0"},
+		"veth1a": {"type": "1", "ifindex": "5", "iflink": "5"},
+		// A container's end of a veth pair, named like a NIC.
+		"ceth0":    {"type": "1", "ifindex": "6", "iflink": "12"},
+		"mv0":      {"type": "1", "ifindex": "7", "iflink": "2", "uevent": "DEVTYPE=macvlan\nINTERFACE=mv0", "lower_eth0": "->"},
+		"ipvl0":    {"type": "1", "ifindex": "8", "iflink": "2", "uevent": "DEVTYPE=ipvlan\nINTERFACE=ipvl0", "lower_eth0": "->"},
+		"eth0.10":  {"type": "1", "ifindex": "9", "iflink": "2", "uevent": "DEVTYPE=vlan\nINTERFACE=eth0.10", "lower_eth0": "->"},
+		"stacked0": {"type": "1", "ifindex": "10", "iflink": "2", "uevent": "INTERFACE=stacked0", "lower_eth0": "->"},
+		"gre1":     {"type": "778", "ifindex": "11", "iflink": "2"},
+		"ip6tnl0":  {"type": "769", "ifindex": "13", "iflink": "0"},
+		"tun0":     {"type": "65534", "ifindex": "14", "iflink": "14", "tun_flags": "0x1002"},
+		"wg0":      {"type": "65534", "ifindex": "15", "iflink": "15", "uevent": "DEVTYPE=wireguard\nINTERFACE=wg0"},
+		"dummy0":   {"type": "1", "ifindex": "16", "iflink": "16"},
+	})
+	useNetClassRoot(t, root)
+
+	tests := map[string]string{
+		"lo":       "loopback",
+		"eth0":     "physical",
+		"wlan0":    "physical",
+		"br0":      "bridge",
+		"veth1a":   "veth",
+		"ceth0":    "veth",
+		"mv0":      "macvlan",
+		"ipvl0":    "ipvlan",
+		"eth0.10":  "vlan",
+		"stacked0": "virtual",
+		"gre1":     "virtual",
+		"ip6tnl0":  "virtual",
+		"tun0":     "tun",
+		"wg0":      "wireguard",
+		"dummy0":   "virtual",
+	}
+	for name, want := range tests {
+		if got := classifyInterface(name); got != want {
+			t.Errorf("classifyInterface(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestClassifyInterfaceCached(t *testing.T) {
+	root := fakeNetClass(t, map[string]map[string]string{
+		"x0": {"type": "1", "ifindex": "20", "iflink": "20", "uevent": "DEVTYPE=bridge"},
+	})
+	useNetClassRoot(t, root)
+
+	if got := classifyInterface("x0"); got != "bridge" {
+		t.Fatalf("classifyInterface = %s, want bridge", got)
+	}
+	uevent := filepath.Join(root, "x0", "uevent")
+	if err := os.WriteFile(uevent, []byte("DEVTYPE=bond\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := classifyInterface("x0"); got != "bridge" {
+		t.Errorf("same ifindex reclassified as %s", got)
+	}
+	// The interface was recreated under the same name.
+	if err := os.WriteFile(filepath.Join(root, "x0", "ifindex"), []byte("21\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := classifyInterface("x0"); got != "bond" {
+		t.Errorf("recreated interface = %s, want bond", got)
+	}
+}
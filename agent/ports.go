@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// portGracePeriod is how long a port that stopped listening is remembered,
+// so a service restart or a socket that is briefly closed does not record
+// a port_opened event when it comes back.
+const portGracePeriod = 15 * time.Minute
+
+type portsConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+type listeningPortInfo struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	// PID and Process are empty when the owner cannot be resolved, e.g. a
+	// process of another user while the agent is not running as root.
+	PID     int    `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+}
+
+func (p listeningPortInfo) key() string {
+	return fmt.Sprintf("%s %s", p.Protocol, net.JoinHostPort(p.Address, strconv.Itoa(p.Port)))
+}
+
+// portSources lists the socket tables and the st value that marks a
+// listening socket: LISTEN for TCP, CLOSE (unconnected) for UDP.
+var portSources = []struct {
+	protocol, path, state string
+}{
+	{"tcp", "/proc/net/tcp", "0A"},
+	{"tcp6", "/proc/net/tcp6", "0A"},
+	{"udp", "/proc/net/udp", "07"},
+	{"udp6", "/proc/net/udp6", "07"},
+}
+
+type portTracker struct {
+	mu sync.Mutex
+	// seen is when each port was last listening.
+	seen   map[string]time.Time
+	primed bool
+}
+
+var listeningPorts = &portTracker{seen: map[string]time.Time{}}
+
+// portRange is an inclusive range of port numbers.
+type portRange struct {
+	low, high int
+}
+
+func (r portRange) contains(port int) bool {
+	return port >= r.low && port <= r.high
+}
+
+// readLocalPortRange returns the range ephemeral ports are allocated from.
+// The zero range, which contains no port, is returned when it is unknown.
+func readLocalPortRange() portRange {
+	fields := strings.Fields(readSysfsString("/proc/sys/net/ipv4/ip_local_port_range"))
+	if len(fields) != 2 {
+		return portRange{}
+	}
+	low, err1 := strconv.Atoi(fields[0])
+	high, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil || low <= 0 || high < low {
+		return portRange{}
+	}
+	return portRange{low: low, high: high}
+}
+
+// readPorts lists listening sockets and resolves their owners from fds,
+// the descriptor walk of this collection.
+func readPorts(fds []procFD) ([]listeningPortInfo, error) {
+	if !cfg.Ports.Enabled {
+		return nil, nil
+	}
+	var ports []listeningPortInfo
+	inodes := map[string]int{}
+	ephemeral := readLocalPortRange()
+	for _, source := range portSources {
+		found, err := readListeningSockets(source.path, source.protocol, source.state, ephemeral)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for inode, port := range found {
+			inodes[inode] = len(ports)
+			ports = append(ports, port)
+		}
+	}
+
+	owners := socketOwners(inodes, fds)
+	for inode, i := range inodes {
+		if pid, ok := owners[inode]; ok {
+			ports[i].PID = pid
+			ports[i].Process = readSysfsString(fmt.Sprintf("/proc/%d/comm", pid))
+		}
+	}
+
+	// SO_REUSEPORT and forked servers yield several sockets per port.
+	unique := make([]listeningPortInfo, 0, len(ports))
+	byKey := map[string]int{}
+	for _, p := range ports {
+		if i, ok := byKey[p.key()]; ok {
+			if unique[i].PID == 0 || (p.PID != 0 && p.PID < unique[i].PID) {
+				unique[i].PID, unique[i].Process = p.PID, p.Process
+			}
+			continue
+		}
+		byKey[p.key()] = len(unique)
+		unique = append(unique, p)
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		if unique[i].Protocol != unique[j].Protocol {
+			return unique[i].Protocol < unique[j].Protocol
+		}
+		if unique[i].Port != unique[j].Port {
+			return unique[i].Port < unique[j].Port
+		}
+		return unique[i].Address < unique[j].Address
+	})
+
+	listeningPorts.track(unique, time.Now())
+	return unique, nil
+}
+
+// track records an event for every port that was not listening within
+// portGracePeriod. The first scan only establishes the baseline.
+func (t *portTracker) track(ports []listeningPortInfo, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range ports {
+		last, seen := t.seen[p.key()]
+		t.seen[p.key()] = now
+		if !t.primed || (seen && now.Sub(last) <= portGracePeriod) {
+			continue
+		}
+		owner := "unknown process"
+		if p.Process != "" {
+			owner = fmt.Sprintf("%s (pid %d)", p.Process, p.PID)
+		}
+		events.record("port_opened", "warning", fmt.Sprintf("new listening port %s by %s", p.key(), owner))
+	}
+	for key, last := range t.seen {
+		if now.Sub(last) > portGracePeriod {
+			delete(t.seen, key)
+		}
+	}
+	t.primed = true
+}
+
+// readListeningSockets returns sockets in the given state keyed by inode.
+// UDP sockets bound to an ephemeral port are left out: they are clients,
+// such as DNS resolvers, that bound without connecting.
+func readListeningSockets(path, protocol, state string, ephemeral portRange) (map[string]listeningPortInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := map[string]listeningPortInfo{}
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+		// An unconnected UDP socket has no remote port; one that called
+		// connect() is a client, not a listener.
+		if strings.HasPrefix(protocol, "udp") && !strings.HasSuffix(fields[2], ":0000") {
+			continue
+		}
+		addr, port, err := parseProcNetAddress(fields[1])
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(protocol, "udp") && ephemeral.contains(port) {
+			continue
+		}
+		result[fields[9]] = listeningPortInfo{Protocol: protocol, Address: addr, Port: port}
+	}
+	return result, scanner.Err()
+}
+
+// parseProcNetAddress decodes "0100007F:0016": an address printed as 32-bit
+// words in host byte order, and a hex port.
+func parseProcNetAddress(value string) (string, int, error) {
+	hexAddr, hexPort, ok := strings.Cut(value, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("bad address %q", value)
+	}
+	raw, err := hex.DecodeString(hexAddr)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, fmt.Errorf("bad address %q", value)
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("bad port %q", value)
+	}
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		binary.NativeEndian.PutUint32(ip[word:], binary.BigEndian.Uint32(raw[word:]))
+	}
+	return ip.String(), int(port), nil
+}
+
+// socketOwners maps socket inodes to the lowest PID holding them open.
+func socketOwners(inodes map[string]int, fds []procFD) map[string]int {
+	owners := map[string]int{}
+	for _, fd := range fds {
+		inode, ok := strings.CutPrefix(fd.Target, "socket:[")
+		if !ok {
+			continue
+		}
+		inode = strings.TrimSuffix(inode, "]")
+		if _, wanted := inodes[inode]; !wanted {
+			continue
+		}
+		if current, ok := owners[inode]; !ok || fd.PID < current {
+			owners[inode] = fd.PID
+		}
+	}
+	return owners
+}
+
+func handlePorts(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !cfg.Ports.Enabled {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("ports inventory disabled"))
+			return
+		}
+
+		procs, err := scanProcesses()
+		if err != nil {
+			log.Printf("scan processes failed: %v", err)
+		}
+		ports, err := readPorts(scanProcessFDs(procs))
+		if err != nil {
+			log.Printf("read ports failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("ports unavailable"))
+			return
+		}
+		writeJSON(w, http.StatusOK, ports)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The fixtures are written as a little-endian kernel prints them.
+func skipUnlessLittleEndian(t *testing.T) {
+	t.Helper()
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("fixtures are in little-endian host byte order")
+	}
+}
+
+func TestParseProcNetAddress(t *testing.T) {
+	skipUnlessLittleEndian(t)
+	tests := []struct {
+		value string
+		addr  string
+		port  int
+		ok    bool
+	}{
+		{"0100007F:0016", "127.0.0.1", 22, true},
+		{"00000000:0035", "0.0.0.0", 53, true},
+		{"0F02000A:01BB", "10.0.2.15", 443, true},
+		{"00000000000000000000000000000000:0050", "::", 80, true},
+		{"00000000000000000000000001000000:1F90", "::1", 8080, true},
+		{"000080FE00000000FF005450563412FE:0222", "fe80::5054:ff:fe12:3456", 546, true},
+		{"B80D0120000000000000000001000000:0035", "2001:db8::1", 53, true},
+		// IPv4-mapped addresses on a dual-stack socket.
+		{"0000000000000000FFFF00000100007F:0CEA", "127.0.0.1", 3306, true},
+		{"0100007F", "", 0, false},
+		{"0100007:0016", "", 0, false},
+		{"0100007F00:0016", "", 0, false},
+		{"0100007F:XYZ", "", 0, false},
+		{"0100007F:10000", "", 0, false},
+	}
+	for _, tt := range tests {
+		addr, port, err := parseProcNetAddress(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseProcNetAddress(%q) error = %v, want ok %v", tt.value, err, tt.ok)
+			continue
+		}
+		if addr != tt.addr || port != tt.port {
+			t.Errorf("parseProcNetAddress(%q) = %s, %d, want %s, %d", tt.value, addr, port, tt.addr, tt.port)
+		}
+	}
+}
+
+func TestReadListeningSockets(t *testing.T) {
+	skipUnlessLittleEndian(t)
+	ephemeral := portRange{low: 32768, high: 60999}
+
+	tcp, err := readListeningSockets(filepath.Join("testdata", "proc_net_tcp"), "tcp", "0A", ephemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A TCP listener on an ephemeral port is still a listener.
+	wantTCP := map[string]listeningPortInfo{
+		"662": {Protocol: "tcp", Address: "0.0.0.0", Port: 2024},
+		"918": {Protocol: "tcp", Address: "127.0.0.1", Port: 48271},
+	}
+	if !reflect.DeepEqual(tcp, wantTCP) {
+		t.Errorf("tcp listeners\n got %v\nwant %v", tcp, wantTCP)
+	}
+
+	// Connected sockets and sockets bound to an ephemeral port are clients.
+	udp, err := readListeningSockets(filepath.Join("testdata", "proc_net_udp"), "udp", "07", ephemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUDP := map[string]listeningPortInfo{
+		"21001": {Protocol: "udp", Address: "0.0.0.0", Port: 53},
+		"21002": {Protocol: "udp", Address: "127.0.0.53", Port: 53},
+	}
+	if !reflect.DeepEqual(udp, wantUDP) {
+		t.Errorf("udp listeners\n got %v\nwant %v", udp, wantUDP)
+	}
+
+	// Without a known range nothing is filtered by port.
+	udp, err = readListeningSockets(filepath.Join("testdata", "proc_net_udp"), "udp", "07", portRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(udp) != 3 {
+		t.Errorf("got %d udp sockets without a port range, want 3", len(udp))
+	}
+}
+
+func TestPortTrackerGracePeriod(t *testing.T) {
+	saved := events
+	t.Cleanup(func() { events = saved })
+	events = &eventLog{}
+
+	ssh := listeningPortInfo{Protocol: "tcp", Address: "0.0.0.0", Port: 22, PID: 1, Process: "sshd"}
+	web := listeningPortInfo{Protocol: "tcp", Address: "0.0.0.0", Port: 8080}
+	tracker := &portTracker{seen: map[string]time.Time{}}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.track([]listeningPortInfo{ssh}, now)
+	// A restart that closes the port for a scan or two is not new.
+	tracker.track(nil, now.Add(time.Minute))
+	tracker.track([]listeningPortInfo{ssh, web}, now.Add(2*time.Minute))
+	tracker.track([]listeningPortInfo{web}, now.Add(3*time.Minute))
+	tracker.track([]listeningPortInfo{ssh, web}, now.Add(10*time.Minute))
+	// Gone for longer than the grace period, it is new again.
+	tracker.track([]listeningPortInfo{ssh}, now.Add(30*time.Minute))
+
+	var messages []string
+	for _, e := range events.since(time.Time{}) {
+		if e.Kind != "port_opened" || e.Severity != "warning" {
+			t.Errorf("event = %+v", e)
+		}
+		messages = append(messages, e.Message)
+	}
+	want := []string{
+		"new listening port tcp 0.0.0.0:8080 by unknown process",
+		"new listening port tcp 0.0.0.0:22 by sshd (pid 1)",
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("events\n got %q\nwant %q", messages, want)
+	}
+	if _, ok := tracker.seen[web.key()]; ok {
+		t.Error("port gone for longer than the grace period is still remembered")
+	}
+}
+
+func TestSocketOwners(t *testing.T) {
+	fds := []procFD{
+		{PID: 300, FD: "3", Target: "socket:[5000]"},
+		{PID: 100, FD: "4", Target: "socket:[5000]"},
+		{PID: 200, FD: "5", Target: "socket:[6000]"},
+		{PID: 200, FD: "6", Target: "socket:[7000]"},
+		{PID: 100, FD: "7", Target: "anon_inode:inotify"},
+	}
+	got := socketOwners(map[string]int{"5000": 0, "6000": 1}, fds)
+	if want := map[string]int{"5000": 100, "6000": 200}; !reflect.DeepEqual(got, want) {
+		t.Errorf("socketOwners = %v, want %v", got, want)
+	}
+}
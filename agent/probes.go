@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeBodyLimit bounds how much of an HTTP response is matched against
+// body_regex.
+const probeBodyLimit = 1 << 20
+
+type probesConfig struct {
+	// History is how many results are kept per probe.
+	History int           `json:"history"`
+	Checks  []probeConfig `json:"checks"`
+}
+
+type probeConfig struct {
+	Name string `json:"name"`
+	// Type is http, tcp, dns or icmp. Target is a URL for http, host:port
+	// for tcp, and a host name or address for dns and icmp.
+	Type   string `json:"type"`
+	Target string `json:"target"`
+	// Interval defaults to 1m, Timeout to 5s and Severity, the health
+	// level of a failing probe, to warning.
+	Interval duration `json:"interval"`
+	Timeout  duration `json:"timeout"`
+	Severity string   `json:"severity"`
+
+	// http: accepted status codes (default 200-399), a regex the body must
+	// match, and whether to skip TLS verification.
+	ExpectStatus []int  `json:"expect_status"`
+	BodyRegex    string `json:"body_regex"`
+	Insecure     bool   `json:"insecure"`
+	// dns: the server to ask (host or host:port) and A, AAAA or empty for
+	// both.
+	Server     string `json:"server"`
+	RecordType string `json:"record_type"`
+}
+
+type probeResult struct {
+	Time      time.Time `json:"time"`
+	OK        bool      `json:"ok"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	Addresses []string  `json:"addresses,omitempty"`
+}
+
+type probeInfo struct {
+	Name           string       `json:"name"`
+	Type           string       `json:"type"`
+	Target         string       `json:"target"`
+	Last           *probeResult `json:"last,omitempty"`
+	SuccessPercent float64      `json:"success_percent"`
+	AvgLatencyMs   float64      `json:"avg_latency_ms"`
+	// History is only returned by GET /probes, oldest first.
+	History []probeResult `json:"history,omitempty"`
+}
+
+func (p probeConfig) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if p.Target == "" {
+		return fmt.Errorf("%s: target is required", p.Name)
+	}
+	switch p.Type {
+	case "http":
+		if !strings.HasPrefix(p.Target, "http://") && !strings.HasPrefix(p.Target, "https://") {
+			return fmt.Errorf("%s: target must be an http or https URL", p.Name)
+		}
+		if _, err := regexp.Compile(p.BodyRegex); err != nil {
+			return fmt.Errorf("%s: bad body_regex: %w", p.Name, err)
+		}
+	case "tcp":
+		if _, _, err := net.SplitHostPort(p.Target); err != nil {
+			return fmt.Errorf("%s: target must be host:port", p.Name)
+		}
+	case "dns":
+		switch p.RecordType {
+		case "", "A", "AAAA":
+		default:
+			return fmt.Errorf("%s: record_type must be A or AAAA", p.Name)
+		}
+	case "icmp":
+	default:
+		return fmt.Errorf("%s: type must be http, tcp, dns or icmp", p.Name)
+	}
+	if p.interval() < time.Second {
+		return fmt.Errorf("%s: interval must be at least 1s", p.Name)
+	}
+	if p.timeout() <= 0 {
+		return fmt.Errorf("%s: timeout must be positive", p.Name)
+	}
+	if healthLevels[p.severity()] == 0 {
+		return fmt.Errorf("%s: severity must be warning or critical", p.Name)
+	}
+	return nil
+}
+
+func (c probesConfig) validate() error {
+	if c.History < 1 {
+		return fmt.Errorf("history must be at least 1")
+	}
+	names := map[string]bool{}
+	for i, probe := range c.Checks {
+		if err := probe.validate(); err != nil {
+			return fmt.Errorf("checks[%d]: %w", i, err)
+		}
+		if names[probe.Name] {
+			return fmt.Errorf("checks[%d]: duplicate name %s", i, probe.Name)
+		}
+		names[probe.Name] = true
+	}
+	return nil
+}
+
+func (p probeConfig) interval() time.Duration {
+	if p.Interval.Duration == 0 {
+		return time.Minute
+	}
+	return p.Interval.Duration
+}
+
+func (p probeConfig) timeout() time.Duration {
+	if p.Timeout.Duration == 0 {
+		return 5 * time.Second
+	}
+	return p.Timeout.Duration
+}
+
+func (p probeConfig) severity() string {
+	if p.Severity == "" {
+		return "warning"
+	}
+	return p.Severity
+}
+
+type probeStore struct {
+	mu      sync.Mutex
+	results map[string][]probeResult
+}
+
+var probes = &probeStore{results: map[string][]probeResult{}}
+
+func (s *probeStore) add(name string, result probeResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history := append(s.results[name], result)
+	if len(history) > cfg.Probes.History {
+		history = append([]probeResult(nil), history[len(history)-cfg.Probes.History:]...)
+	}
+	s.results[name] = history
+}
+
+// runProbes starts one loop per configured probe, each on its own interval.
+func runProbes() {
+	for _, probe := range cfg.Probes.Checks {
+		go runProbe(probe)
+	}
+}
+
+func runProbe(probe probeConfig) {
+	var body *regexp.Regexp
+	if probe.BodyRegex != "" {
+		body = regexp.MustCompile(probe.BodyRegex)
+	}
+	ticker := time.NewTicker(probe.interval())
+	defer ticker.Stop()
+	for {
+		probes.add(probe.Name, runProbeOnce(probe, body))
+		<-ticker.C
+	}
+}
+
+func runProbeOnce(probe probeConfig, body *regexp.Regexp) probeResult {
+	ctx, cancel := context.WithTimeout(context.Background(), probe.timeout())
+	defer cancel()
+
+	result := probeResult{Time: time.Now().UTC()}
+	start := time.Now()
+	var err error
+	switch probe.Type {
+	case "http":
+		result.Status, err = probeHTTP(ctx, probe, body)
+	case "tcp":
+		err = probeTCP(ctx, probe.Target)
+	case "dns":
+		result.Addresses, err = probeDNS(ctx, probe)
+	case "icmp":
+		err = probeICMP(ctx, probe.Target)
+	}
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	result.OK = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func probeHTTP(ctx context.Context, probe probeConfig, body *regexp.Regexp) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.Target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "stackscope-agent")
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: probe.Insecure},
+		DisableKeepAlives: true,
+	}
+	// A redirect is the answer being checked; following it would test
+	// another URL.
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if !expectedStatus(probe.ExpectStatus, resp.StatusCode) {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if body != nil {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, probeBodyLimit))
+		if err != nil {
+			return resp.StatusCode, err
+		}
+		if !body.Match(data) {
+			return resp.StatusCode, fmt.Errorf("body does not match %q", probe.BodyRegex)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func expectedStatus(expected []int, status int) bool {
+	if len(expected) == 0 {
+		return status >= 200 && status < 400
+	}
+	for _, code := range expected {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+func probeTCP(ctx context.Context, target string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeDNS resolves the target against the configured server, or the
+// system resolver when no server is set.
+func probeDNS(ctx context.Context, probe probeConfig) ([]string, error) {
+	resolver := net.DefaultResolver
+	if probe.Server != "" {
+		server := probe.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	network := "ip"
+	switch probe.RecordType {
+	case "A":
+		network = "ip4"
+	case "AAAA":
+		network = "ip6"
+	}
+	ips, err := resolver.LookupIP(ctx, network, probe.Target)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, ip.String())
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// readProbes summarizes every configured probe; withHistory adds the
+// stored results.
+func readProbes(withHistory bool) []probeInfo {
+	if len(cfg.Probes.Checks) == 0 {
+		return nil
+	}
+	probes.mu.Lock()
+	defer probes.mu.Unlock()
+	result := make([]probeInfo, 0, len(cfg.Probes.Checks))
+	for _, probe := range cfg.Probes.Checks {
+		info := probeInfo{Name: probe.Name, Type: probe.Type, Target: probe.Target}
+		history := probes.results[probe.Name]
+		if len(history) > 0 {
+			last := history[len(history)-1]
+			info.Last = &last
+			var ok int
+			var latency float64
+			for _, r := range history {
+				if r.OK {
+					ok++
+					latency += r.LatencyMs
+				}
+			}
+			info.SuccessPercent = percent(float64(ok), float64(len(history)))
+			if ok > 0 {
+				info.AvgLatencyMs = latency / float64(ok)
+			}
+		}
+		if withHistory {
+			info.History = append([]probeResult{}, history...)
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+func handleProbes(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		result := readProbes(true)
+		if result == nil {
+			result = []probeInfo{}
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func evaluateProbesHealth(health *healthInfo, infos []probeInfo) {
+	severities := map[string]string{}
+	for _, probe := range cfg.Probes.Checks {
+		severities[probe.Name] = probe.severity()
+	}
+	for _, info := range infos {
+		if info.Last == nil || info.Last.OK {
+			continue
+		}
+		health.degrade(severities[info.Name], fmt.Sprintf("probe '%s' failed: %s", info.Name, info.Last.Error))
+	}
+}
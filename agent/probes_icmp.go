@@ -0,0 +1,98 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	icmpEchoRequest   = 8
+	icmpEchoReply     = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// probeICMP sends one echo request over an unprivileged ICMP datagram
+// socket and waits for the reply. The kernel fills in the identifier and
+// checksum; the agent's group must be within net.ipv4.ping_group_range.
+func probeICMP(ctx context.Context, target string) error {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", target)
+	if err != nil {
+		return err
+	}
+	ip := ips[0]
+	for _, candidate := range ips {
+		if candidate.To4() != nil {
+			ip = candidate
+			break
+		}
+	}
+
+	family, proto, request, reply := syscall.AF_INET6, syscall.IPPROTO_ICMPV6, byte(icmpv6EchoRequest), byte(icmpv6EchoReply)
+	var addr syscall.Sockaddr
+	if ip4 := ip.To4(); ip4 != nil {
+		family, proto, request, reply = syscall.AF_INET, syscall.IPPROTO_ICMP, icmpEchoRequest, icmpEchoReply
+		sa := &syscall.SockaddrInet4{}
+		copy(sa.Addr[:], ip4)
+		addr = sa
+	} else {
+		sa := &syscall.SockaddrInet6{}
+		copy(sa.Addr[:], ip.To16())
+		addr = sa
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, proto)
+	if err != nil {
+		if errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM) {
+			return fmt.Errorf("icmp socket not permitted, check net.ipv4.ping_group_range: %w", err)
+		}
+		return err
+	}
+	defer syscall.Close(fd)
+	// A zero SO_RCVTIMEO would block forever.
+	deadline, _ := ctx.Deadline()
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return context.DeadlineExceeded
+	}
+	tv := syscall.NsecToTimeval(remaining.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return err
+	}
+
+	seq := uint16(time.Now().UnixNano())
+	packet := make([]byte, 16)
+	packet[0] = request
+	binary.BigEndian.PutUint16(packet[6:8], seq)
+	copy(packet[8:], "stackscp")
+	if err := syscall.Sendto(fd, packet, 0, addr); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for ctx.Err() == nil {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			if errors.Is(err, syscall.EAGAIN) {
+				return fmt.Errorf("no reply from %s", ip)
+			}
+			return err
+		}
+		// Datagram ICMP sockets deliver the ICMP message without the IP
+		// header, and only replies to this socket's identifier.
+		if n >= 8 && buf[0] == reply && binary.BigEndian.Uint16(buf[6:8]) == seq {
+			return nil
+		}
+	}
+	return fmt.Errorf("no reply from %s", ip)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// probeICMP needs Linux's unprivileged ICMP datagram sockets.
+func probeICMP(ctx context.Context, target string) error {
+	return errors.New("icmp probes are only supported on Linux")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			_, _ = w.Write([]byte(`{"status":"ok","version":"1.4.2"}`))
+		case "/degraded":
+			_, _ = w.Write([]byte(`{"status":"degraded"}`))
+		case "/error":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case "/moved":
+			http.Redirect(w, r, "/error", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name   string
+		path   string
+		expect []int
+		regex  string
+		ok     bool
+		status int
+		err    string
+	}{
+		{name: "ok", path: "/healthz", ok: true, status: 200},
+		{name: "body matches", path: "/healthz", regex: `"status":"ok"`, ok: true, status: 200},
+		{name: "body does not match", path: "/degraded", regex: `"status":"ok"`, status: 200, err: `body does not match "\"status\":\"ok\""`},
+		{name: "server error", path: "/error", status: 500, err: "unexpected status 500"},
+		{name: "not found", path: "/missing", status: 404, err: "unexpected status 404"},
+		{name: "expected status", path: "/missing", expect: []int{404}, ok: true, status: 404},
+		{name: "status outside expect_status", path: "/healthz", expect: []int{204}, status: 200, err: "unexpected status 200"},
+		// The redirect is checked itself rather than the failing page behind it.
+		{name: "redirect not followed", path: "/moved", ok: true, status: 302},
+		{name: "redirect not expected", path: "/moved", expect: []int{200}, status: 302, err: "unexpected status 302"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe := probeConfig{Name: tt.name, Type: "http", Target: server.URL + tt.path, ExpectStatus: tt.expect, BodyRegex: tt.regex}
+			var body *regexp.Regexp
+			if tt.regex != "" {
+				body = regexp.MustCompile(tt.regex)
+			}
+			result := runProbeOnce(probe, body)
+			if result.OK != tt.ok || result.Status != tt.status || result.Error != tt.err {
+				t.Errorf("result = ok %v, status %d, error %q; want ok %v, status %d, error %q",
+					result.OK, result.Status, result.Error, tt.ok, tt.status, tt.err)
+			}
+		})
+	}
+}
+
+func TestProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := listener.Addr().String()
+	probe := probeConfig{Name: "local", Type: "tcp", Target: target, Timeout: duration{2 * time.Second}}
+	if result := runProbeOnce(probe, nil); !result.OK || result.Error != "" {
+		t.Errorf("connect to a listener = %+v", result)
+	}
+
+	listener.Close()
+	if result := runProbeOnce(probe, nil); result.OK || result.Error == "" {
+		t.Errorf("connect to a closed port = %+v", result)
+	}
+}
+
+func TestProbeStoreAdd(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+	cfg.Probes.History = 3
+
+	store := &probeStore{results: map[string][]probeResult{}}
+	start := time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		store.add("web", probeResult{Time: start.Add(time.Duration(i) * time.Minute), OK: i%2 == 0})
+	}
+	store.add("dns", probeResult{Time: start, OK: true})
+
+	history := store.results["web"]
+	if len(history) != 3 {
+		t.Fatalf("kept %d results, want 3", len(history))
+	}
+	for i, result := range history {
+		if want := start.Add(time.Duration(i+2) * time.Minute); !result.Time.Equal(want) {
+			t.Errorf("result %d at %s, want %s", i, result.Time, want)
+		}
+	}
+	if len(store.results["dns"]) != 1 {
+		t.Errorf("dns history = %+v, want one result", store.results["dns"])
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// clockTicks is USER_HZ, the unit of time fields in /proc/<pid>/stat.
+// It is 100 on every Linux architecture the agent is built for.
+const clockTicks = 100
+
+// maxCommandLength keeps huge command lines (e.g. JVM classpaths) from
+// bloating the payload.
+const maxCommandLength = 512
+
+type processesConfig struct {
+	TopN           int            `json:"top_n"`
+	SortBy         []string       `json:"sort_by"`
+	RedactCmdline  bool           `json:"redact_cmdline"`
+	RedactPatterns []string       `json:"redact_patterns"`
+	Watch          []processWatch `json:"watch"`
+}
+
+type processInfo struct {
+	PID        int     `json:"pid"`
+	Command    string  `json:"command"`
+	User       string  `json:"user,omitempty"`
+	State      string  `json:"state,omitempty"`
+	Threads    int     `json:"threads,omitempty"`
+	StartedAt  string  `json:"started_at,omitempty"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSSMB      float64 `json:"rss_mb"`
+	ReadBytes  uint64  `json:"read_bytes,omitempty"`
+	WriteBytes uint64  `json:"write_bytes,omitempty"`
+	ReadBps    float64 `json:"read_bps,omitempty"`
+	WriteBps   float64 `json:"write_bps,omitempty"`
+}
+
+type procStat struct {
+	PID        int
+	Comm       string
+	State      string
+	PPID       int
+	UTime      uint64
+	STime      uint64
+	Threads    int
+	StartTicks uint64
+	RSSPages   int64
+}
+
+func (p procStat) startTime(boot time.Time) time.Time {
+	return boot.Add(time.Duration(p.StartTicks) * time.Second / clockTicks)
+}
+
+var processSortKeys = map[string]func(processInfo) float64{
+	"cpu":    func(p processInfo) float64 { return p.CPUPercent },
+	"memory": func(p processInfo) float64 { return p.RSSMB },
+	"io":     func(p processInfo) float64 { return p.ReadBps + p.WriteBps },
+}
+
+var processRates = newRateTracker()
+
+// procRoot is where the descriptor walk and its consumers read /proc.
+var procRoot = "/proc"
+
+// procFD is an open descriptor of a process and the target of its
+// /proc/<pid>/fd link, e.g. "socket:[1234]" or "anon_inode:inotify".
+type procFD struct {
+	PID    int
+	FD     string
+	Target string
+}
+
+// scanProcesses parses /proc/<pid>/stat for every process. Processes that
+// exit during the scan are skipped.
+func scanProcesses() ([]procStat, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	procs := make([]procStat, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		stat, err := readProcStat(entry.Name())
+		if err != nil {
+			continue
+		}
+		procs = append(procs, stat)
+	}
+	return procs, nil
+}
+
+// scanProcessFDs walks /proc/<pid>/fd of the scanned processes. It is done
+// once per collection and shared by everything that looks for sockets or
+// inotify instances. Processes the agent may not inspect are skipped.
+func scanProcessFDs(procs []procStat) []procFD {
+	var fds []procFD
+	for _, proc := range procs {
+		dir := filepath.Join(procRoot, strconv.Itoa(proc.PID), "fd")
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			fds = append(fds, procFD{PID: proc.PID, FD: entry.Name(), Target: target})
+		}
+	}
+	return fds
+}
+
+func readProcStat(pid string) (procStat, error) {
+	data, err := os.ReadFile("/proc/" + pid + "/stat")
+	if err != nil {
+		return procStat{}, err
+	}
+	// The command name may contain spaces and parens; it ends at the last ')'.
+	stat := string(data)
+	open := strings.Index(stat, "(")
+	end := strings.LastIndex(stat, ")")
+	if open < 0 || end < open {
+		return procStat{}, fmt.Errorf("unexpected /proc/%s/stat format", pid)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("unexpected /proc/%s/stat format", pid)
+	}
+
+	// fields[0] is field 3 (state) in proc(5) numbering.
+	parsed := procStat{
+		Comm:  stat[open+1 : end],
+		State: fields[0],
+	}
+	parsed.PID, _ = strconv.Atoi(strings.TrimSpace(stat[:open]))
+	parsed.PPID, _ = strconv.Atoi(fields[1])
+	parsed.UTime, _ = strconv.ParseUint(fields[11], 10, 64)
+	parsed.STime, _ = strconv.ParseUint(fields[12], 10, 64)
+	parsed.Threads, _ = strconv.Atoi(fields[17])
+	parsed.StartTicks, _ = strconv.ParseUint(fields[19], 10, 64)
+	parsed.RSSPages, _ = strconv.ParseInt(fields[21], 10, 64)
+	return parsed, nil
+}
+
+// measureProcesses converts a scan into processInfo with CPU and I/O rates
+// since the previous collection. Each scan must be measured exactly once.
+// /proc/<pid>/io is read for every process only when I/O is a sort key;
+// otherwise topProcesses reads it for the selected processes.
+func measureProcesses(procs []procStat, now time.Time) []processInfo {
+	readIO := sortsByIO()
+
+	pageMB := float64(os.Getpagesize()) / (1024.0 * 1024.0)
+	measured := make([]processInfo, 0, len(procs))
+	for _, proc := range procs {
+		key := processKey(proc)
+		info := processInfo{
+			PID:     proc.PID,
+			Command: proc.Comm,
+			State:   proc.State,
+			Threads: proc.Threads,
+			RSSMB:   float64(proc.RSSPages) * pageMB,
+		}
+		if rate, ok := processRates.rate(key+"/cpu", proc.UTime+proc.STime, now); ok {
+			info.CPUPercent = rate / clockTicks * 100
+		}
+		if readIO {
+			measureProcessIO(&info, key, now)
+		}
+		measured = append(measured, info)
+	}
+	return measured
+}
+
+// processKey identifies a process by PID and start time so a recycled PID
+// does not inherit counters.
+func processKey(proc procStat) string {
+	return strconv.Itoa(proc.PID) + "/" + strconv.FormatUint(proc.StartTicks, 10)
+}
+
+func measureProcessIO(info *processInfo, key string, now time.Time) {
+	info.ReadBytes, info.WriteBytes = readProcIO(strconv.Itoa(info.PID))
+	info.ReadBps, _ = processRates.rate(key+"/read", info.ReadBytes, now)
+	info.WriteBps, _ = processRates.rate(key+"/write", info.WriteBytes, now)
+}
+
+func sortsByIO() bool {
+	for _, key := range cfg.Processes.SortBy {
+		if key == "io" {
+			return true
+		}
+	}
+	return false
+}
+
+// topProcesses returns the union of the heaviest processes for each
+// configured sort key, ordered by the first key.
+func topProcesses(procs []procStat, measured []processInfo, now time.Time) []processInfo {
+	limit := cfg.Processes.TopN
+	if limit <= 0 || len(cfg.Processes.SortBy) == 0 {
+		return nil
+	}
+
+	candidates := append([]processInfo(nil), measured...)
+	selected := map[int]bool{}
+	var top []processInfo
+	for _, key := range cfg.Processes.SortBy {
+		value := processSortKeys[key]
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return value(candidates[i]) > value(candidates[j])
+		})
+		for i := 0; i < len(candidates) && i < limit; i++ {
+			if value(candidates[i]) <= 0 || selected[candidates[i].PID] {
+				continue
+			}
+			selected[candidates[i].PID] = true
+			top = append(top, candidates[i])
+		}
+	}
+
+	primary := processSortKeys[cfg.Processes.SortBy[0]]
+	sort.SliceStable(top, func(i, j int) bool {
+		return primary(top[i]) > primary(top[j])
+	})
+
+	boot, bootErr := time.Parse(time.RFC3339, readBootTime())
+	redactors := compileRedactPatterns(cfg.Processes.RedactPatterns)
+	byPID := make(map[int]procStat, len(procs))
+	for _, proc := range procs {
+		byPID[proc.PID] = proc
+	}
+	readIO := !sortsByIO()
+	for i := range top {
+		pid := strconv.Itoa(top[i].PID)
+		if readIO {
+			measureProcessIO(&top[i], processKey(byPID[top[i].PID]), now)
+		}
+		top[i].Command = readProcCommand(pid, top[i].Command, cfg.Processes.RedactCmdline, redactors)
+		top[i].User = readProcUser(pid)
+		if bootErr == nil {
+			top[i].StartedAt = byPID[top[i].PID].startTime(boot).UTC().Format(time.RFC3339)
+		}
+	}
+	return top
+}
+
+func readProcIO(pid string) (uint64, uint64) {
+	data, err := os.ReadFile("/proc/" + pid + "/io")
+	if err != nil {
+		return 0, 0
+	}
+	var readBytes, writeBytes uint64
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "read_bytes":
+			readBytes, _ = strconv.ParseUint(value, 10, 64)
+		case "write_bytes":
+			writeBytes, _ = strconv.ParseUint(value, 10, 64)
+		}
+	}
+	return readBytes, writeBytes
+}
+
+// readProcCommand returns the command line, or "[comm]" for kernel threads.
+// With redactArgs only the executable is kept.
+func readProcCommand(pid, comm string, redactArgs bool, redactors []*regexp.Regexp) string {
+	data, err := os.ReadFile("/proc/" + pid + "/cmdline")
+	if err != nil || len(data) == 0 {
+		return "[" + comm + "]"
+	}
+	args := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	if redactArgs {
+		return args[0]
+	}
+	return truncateCommand(redactCommand(strings.Join(args, " "), redactors))
+}
+
+// truncateCommand cuts command to maxCommandLength bytes without splitting
+// a UTF-8 sequence.
+func truncateCommand(command string) string {
+	if len(command) <= maxCommandLength {
+		return command
+	}
+	cut := maxCommandLength
+	for cut > 0 && !utf8.RuneStart(command[cut]) {
+		cut--
+	}
+	return command[:cut] + "..."
+}
+
+// redactCommand masks every match of the patterns. When a pattern has a
+// capture group only the first group is masked, so "--password=***" keeps
+// the flag name.
+func redactCommand(command string, redactors []*regexp.Regexp) string {
+	for _, re := range redactors {
+		matches := re.FindAllStringSubmatchIndex(command, -1)
+		for i := len(matches) - 1; i >= 0; i-- {
+			start, end := matches[i][0], matches[i][1]
+			if len(matches[i]) >= 4 && matches[i][2] >= 0 {
+				start, end = matches[i][2], matches[i][3]
+			}
+			command = command[:start] + "***" + command[end:]
+		}
+	}
+	return command
+}
+
+func compileRedactPatterns(patterns []string) []*regexp.Regexp {
+	var result []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		result = append(result, re)
+	}
+	return result
+}
+
+var (
+	userNamesMu sync.Mutex
+	userNames   = map[string]string{}
+)
+
+func readProcUser(pid string) string {
+	return lookupUserName(readProcUID(pid))
+}
+
+func lookupUserName(uid string) string {
+	if uid == "" {
+		return ""
+	}
+	userNamesMu.Lock()
+	defer userNamesMu.Unlock()
+	if name, ok := userNames[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	userNames[uid] = name
+	return name
+}
+
+// readProcUID returns the real UID from /proc/<pid>/status.
+func readProcUID(pid string) string {
+	data, err := os.ReadFile(filepath.Join(procRoot, pid, "status"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "Uid:"); ok {
+			fields := strings.Fields(rest)
+			if len(fields) > 0 {
+				return fields[0]
+			}
+		}
+	}
+	return ""
+}
+
+func (c processesConfig) validate() error {
+	for _, key := range c.SortBy {
+		if _, ok := processSortKeys[key]; !ok {
+			return fmt.Errorf("unknown sort key %q", key)
+		}
+	}
+	for _, pattern := range c.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return err
+		}
+	}
+	for i, watch := range c.Watch {
+		if err := watch.validate(); err != nil {
+			return fmt.Errorf("watch[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRedactCommand(t *testing.T) {
+	defaults := compileRedactPatterns(defaultConfig().Processes.RedactPatterns)
+	tests := []struct {
+		name      string
+		command   string
+		redactors []*regexp.Regexp
+		want      string
+	}{
+		{"no secrets", "nginx -g daemon off;", defaults, "nginx -g daemon off;"},
+		{"flag with equals", "app --password=hunter2 --port=80", defaults, "app --password=*** --port=80"},
+		{"flag with space", "mysql -u root --passwd s3cret", defaults, "mysql -u root --passwd ***"},
+		{"case insensitive", "app TOKEN=abc", defaults, "app TOKEN=***"},
+		{"api key spellings", "cli --api-key=k1 --api_key=k2 --apikey:k3", defaults, "cli --api-key=*** --api_key=*** --apikey:***"},
+		{"every match", "app --secret=a --secret=b", defaults, "app --secret=*** --secret=***"},
+		{"pattern without group", "curl https://user:pw@example.com",
+			compileRedactPatterns([]string{`//[^@/]+@`}), "curl https:***example.com"},
+		{"no patterns", "app --password=hunter2", nil, "app --password=hunter2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactCommand(tt.command, tt.redactors); got != tt.want {
+				t.Errorf("redactCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRedactPatternsSkipsInvalid(t *testing.T) {
+	if got := compileRedactPatterns([]string{"(", "ok"}); len(got) != 1 {
+		t.Errorf("compiled %d patterns, want 1", len(got))
+	}
+}
+
+func TestTruncateCommand(t *testing.T) {
+	short := "java -jar app.jar"
+	if got := truncateCommand(short); got != short {
+		t.Errorf("short command changed to %q", got)
+	}
+
+	// A three-byte rune straddles the limit.
+	long := strings.Repeat("a", maxCommandLength-1) + "€" + strings.Repeat("b", 10)
+	got := truncateCommand(long)
+	if !utf8.ValidString(got) {
+		t.Errorf("truncated command is not valid UTF-8: %q", got[len(got)-8:])
+	}
+	if want := strings.Repeat("a", maxCommandLength-1) + "..."; got != want {
+		t.Errorf("truncated to %d bytes, want %d", len(got), len(want))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// maxCounterWrapRate bounds the growth per second accepted across a 32-bit
+// wrap, 10 Gbit/s in bytes. Hardware fast enough to exceed it does not
+// export 32-bit counters, and a larger jump is more likely a reset.
+const maxCounterWrapRate = 1.25e9
+
+// counterDelta returns how much a monotonically increasing 64-bit counter
+// grew from prev to cur. A counter that went backwards was reset by a
+// reboot, process restart or device re-creation; ok is false, so callers
+// drop the sample instead of reporting a huge spike.
+func counterDelta(prev, cur uint64) (uint64, bool) {
+	if cur < prev {
+		return 0, false
+	}
+	return cur - prev, true
+}
+
+// counter32Delta is counterDelta for kernel counters that may be only 32
+// bits wide: unsigned long in /proc on 32-bit kernels, and some NIC drivers.
+// A drop is taken as a wrap when prev fits in 32 bits and the wrapped growth
+// over seconds stays within maxCounterWrapRate; anything else is a reset.
+func counter32Delta(prev, cur uint64, seconds float64) (uint64, bool) {
+	if cur >= prev {
+		return cur - prev, true
+	}
+	if prev <= math.MaxUint32 && cur <= math.MaxUint32 {
+		if wrapped := math.MaxUint32 - prev + cur + 1; float64(wrapped) <= maxCounterWrapRate*seconds {
+			return wrapped, true
+		}
+	}
+	return 0, false
+}
+
+// counterRate is counterDelta per second.
+func counterRate(prev, cur uint64, seconds float64) (float64, bool) {
+	if seconds <= 0 {
+		return 0, false
+	}
+	delta, ok := counterDelta(prev, cur)
+	if !ok {
+		return 0, false
+	}
+	return float64(delta) / seconds, true
+}
+
+// counter32Rate is counter32Delta per second.
+func counter32Rate(prev, cur uint64, seconds float64) (float64, bool) {
+	if seconds <= 0 {
+		return 0, false
+	}
+	delta, ok := counter32Delta(prev, cur, seconds)
+	if !ok {
+		return 0, false
+	}
+	return float64(delta) / seconds, true
+}
+
+// rateTracker remembers the last value of monotonically increasing counters
+// so rates can be computed between two collections instead of sleeping
+// inside a request. Trackers for counters that may be 32 bits wide set
+// wrap32.
+type rateTracker struct {
+	mu        sync.Mutex
+	samples   map[string]rateSample
+	lastPrune time.Time
+	wrap32    bool
+}
+
+type rateSample struct {
+	value uint64
+	at    time.Time
+}
+
+const rateSampleTTL = 10 * time.Minute
+
+func newRateTracker() *rateTracker {
+	return &rateTracker{samples: make(map[string]rateSample)}
+}
+
+// rate records value for key and returns the per-second change since the
+// previous sample. ok is false for the first sample of a key and after a
+// counter reset.
+func (t *rateTracker) rate(key string, value uint64, now time.Time) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastPrune) > rateSampleTTL {
+		for k, s := range t.samples {
+			if now.Sub(s.at) > rateSampleTTL {
+				delete(t.samples, k)
+			}
+		}
+		t.lastPrune = now
+	}
+
+	prev, seen := t.samples[key]
+	t.samples[key] = rateSample{value: value, at: now}
+	if !seen {
+		return 0, false
+	}
+	if t.wrap32 {
+		return counter32Rate(prev.value, value, now.Sub(prev.at).Seconds())
+	}
+	return counterRate(prev.value, value, now.Sub(prev.at).Seconds())
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur uint64
+		want      uint64
+		ok        bool
+	}{
+		{"growth", 100, 250, 150, true},
+		{"unchanged", 100, 100, 0, true},
+		{"reset", 5000, 10, 0, false},
+		// A 64-bit counter still below 2^32 that resets is not a wrap.
+		{"reset below 32 bits", 4.0e9, 1000, 0, false},
+		{"reset near 32-bit limit", math.MaxUint32 - 10, 5, 0, false},
+		{"large growth", 1 << 40, 1<<40 + 1<<35, 1 << 35, true},
+	}
+	for _, tt := range tests {
+		got, ok := counterDelta(tt.prev, tt.cur)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: counterDelta(%d, %d) = %d, %v, want %d, %v", tt.name, tt.prev, tt.cur, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCounter32Delta(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur uint64
+		seconds   float64
+		want      uint64
+		ok        bool
+	}{
+		{"growth", 100, 250, 1, 150, true},
+		{"wrap", math.MaxUint32 - 99, 50, 1, 150, true},
+		{"wrap to zero", math.MaxUint32, 0, 1, 1, true},
+		// 3.8e9 in ten minutes is 6.3 MB/s, a plain wrap.
+		{"wrap over a long interval", 1e9, 5e8, 600, 3794967296, true},
+		// 295 MB in 100ms would be 2.9 GB/s: a reset that landed low.
+		{"reset below 32 bits", 4.0e9, 1000, 0.1, 0, false},
+		{"reset of a 64-bit value", 1 << 33, 1000, 1, 0, false},
+		{"drop without an interval", math.MaxUint32 - 99, 50, 0, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := counter32Delta(tt.prev, tt.cur, tt.seconds)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: counter32Delta(%d, %d, %g) = %d, %v, want %d, %v", tt.name, tt.prev, tt.cur, tt.seconds, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCounterRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      func(prev, cur uint64, seconds float64) (float64, bool)
+		prev, cur uint64
+		seconds   float64
+		want      float64
+		ok        bool
+	}{
+		{"growth", counterRate, 100, 300, 2, 100, true},
+		{"zero interval", counterRate, 100, 300, 0, 0, false},
+		{"negative interval", counterRate, 100, 300, -1, 0, false},
+		{"reset", counterRate, 300, 100, 2, 0, false},
+		{"64-bit counters do not wrap", counterRate, math.MaxUint32 - 99, 100, 2, 0, false},
+		{"32-bit growth", counter32Rate, 100, 300, 2, 100, true},
+		{"32-bit wrap", counter32Rate, math.MaxUint32 - 99, 100, 2, 100, true},
+		{"32-bit zero interval", counter32Rate, math.MaxUint32 - 99, 100, 0, 0, false},
+		{"32-bit reset", counter32Rate, 1 << 33, 100, 2, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.rate(tt.prev, tt.cur, tt.seconds)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: rate(%d, %d, %g) = %g, %v, want %g, %v", tt.name, tt.prev, tt.cur, tt.seconds, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRateTracker(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	type sample struct {
+		value  uint64
+		offset time.Duration
+		want   float64
+		ok     bool
+	}
+	tests := []struct {
+		name    string
+		tracker *rateTracker
+		samples []sample
+	}{
+		{
+			name:    "first sample then growth",
+			tracker: newRateTracker(),
+			samples: []sample{{1000, 0, 0, false}, {3000, 2 * time.Second, 1000, true}, {3000, 3 * time.Second, 0, true}},
+		},
+		{
+			name:    "reset drops one sample",
+			tracker: newRateTracker(),
+			samples: []sample{{5000, 0, 0, false}, {100, time.Second, 0, false}, {600, 2 * time.Second, 500, true}},
+		},
+		{
+			name:    "same instant",
+			tracker: newRateTracker(),
+			samples: []sample{{1000, 0, 0, false}, {2000, 0, 0, false}},
+		},
+		{
+			name:    "64-bit tracker treats a drop as a reset",
+			tracker: newRateTracker(),
+			samples: []sample{{math.MaxUint32 - 99, 0, 0, false}, {100, time.Second, 0, false}},
+		},
+		{
+			name:    "32-bit tracker accounts for a wrap",
+			tracker: &rateTracker{samples: make(map[string]rateSample), wrap32: true},
+			samples: []sample{{math.MaxUint32 - 99, 0, 0, false}, {100, time.Second, 200, true}},
+		},
+		{
+			name:    "expired sample starts over",
+			tracker: newRateTracker(),
+			samples: []sample{{1000, 0, 0, false}, {2000, rateSampleTTL + time.Minute, 0, false}},
+		},
+	}
+	for _, tt := range tests {
+		for i, s := range tt.samples {
+			got, ok := tt.tracker.rate("key", s.value, start.Add(s.offset))
+			if got != s.want || ok != s.ok {
+				t.Errorf("%s: sample %d = %g, %v, want %g, %v", tt.name, i, got, ok, s.want, s.ok)
+			}
+		}
+	}
+}
+
+func TestCalcRate(t *testing.T) {
+	if got, ok := calcRate(100, 400, 3*time.Second); got != 100 || !ok {
+		t.Errorf("calcRate growth = %g, %v, want 100, true", got, ok)
+	}
+	if got, ok := calcRate(100, 400, 0); got != 0 || ok {
+		t.Errorf("calcRate zero interval = %g, %v, want 0, false", got, ok)
+	}
+	if got, ok := calcRate(math.MaxUint32-99, 100, time.Second); got != 0 || ok {
+		t.Errorf("calcRate across a 64-bit reset = %g, %v, want 0, false", got, ok)
+	}
+
+	tests := []struct {
+		name          string
+		before, after uint64
+		interval      float64
+		want          float64
+		ok            bool
+	}{
+		{"growth", 1000, 3000, 2, 1000, true},
+		{"wrap", math.MaxUint32 - 999, 1000, 2, 1000, true},
+		{"reset", 1 << 33, 1000, 2, 0, false},
+		{"zero interval", 1000, 3000, 0, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := calcRateInt64(tt.before, tt.after, tt.interval); got != int64(tt.want) || ok != tt.ok {
+			t.Errorf("%s: calcRateInt64 = %d, %v, want %d, %v", tt.name, got, ok, int64(tt.want), tt.ok)
+		}
+		if got, ok := calcRateFloat(tt.before, tt.after, tt.interval); got != tt.want || ok != tt.ok {
+			t.Errorf("%s: calcRateFloat = %g, %v, want %g, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCounterDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after uint64
+		want          float64
+	}{
+		{"growth", 1000, 1250, 250},
+		{"unchanged", 1000, 1000, 0},
+		// iowait going backwards is clamped, not read as a wrap.
+		{"backwards", 1000, 990, 0},
+		{"backwards near 32-bit limit", math.MaxUint32 - 5, 10, 0},
+	}
+	for _, tt := range tests {
+		if got := counterDiff(tt.before, tt.after); got != tt.want {
+			t.Errorf("%s: counterDiff(%d, %d) = %g, want %g", tt.name, tt.before, tt.after, got, tt.want)
+		}
+	}
+}
+
+// Sector counters wrap at 2^32 sectors, so the delta is taken before
+// scaling to bytes.
+func TestDiskSectorWrap(t *testing.T) {
+	before := diskCounters{readSectors: math.MaxUint32 - 999}
+	after := diskCounters{readSectors: 1000}
+	if got, ok := calcRateInt64(before.readSectors, after.readSectors, 2); got*512 != 512000 || !ok {
+		t.Errorf("read rate across a sector wrap = %d, %v, want 512000", got*512, ok)
+	}
+}
+
+func TestTrafficDelta(t *testing.T) {
+	tests := []struct {
+		name          string
+		last, current uint64
+		rebooted      bool
+		want          uint64
+	}{
+		{"growth", 1000, 5000, false, 4000},
+		{"wrap", math.MaxUint32 - 999, 1000, false, 2000},
+		{"interface recreated", 1 << 33, 1000, false, 1000},
+		{"reboot", 1000, 5000, true, 5000},
+	}
+	for _, tt := range tests {
+		if got := trafficDelta(tt.last, tt.current, 60, tt.rebooted); got != tt.want {
+			t.Errorf("%s: trafficDelta = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
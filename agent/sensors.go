@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	hwmonRoot   = "/sys/class/hwmon"
+	thermalRoot = "/sys/class/thermal"
+)
+
+type sensorsConfig struct {
+	Enabled bool `json:"enabled"`
+	// CritMargin is how many °C below a sensor's crit threshold a warning fires.
+	CritMargin float64 `json:"crit_margin"`
+}
+
+// sensorsInfo groups readings by kind. Units: °C, RPM, V and W.
+type sensorsInfo struct {
+	Temperatures []sensorReading `json:"temperatures,omitempty"`
+	Fans         []sensorReading `json:"fans,omitempty"`
+	Voltages     []sensorReading `json:"voltages,omitempty"`
+	Power        []sensorReading `json:"power,omitempty"`
+}
+
+type sensorReading struct {
+	Chip  string  `json:"chip"`
+	Label string  `json:"label"`
+	Value float64 `json:"value"`
+	Min   float64 `json:"min,omitempty"`
+	Max   float64 `json:"max,omitempty"`
+	Crit  float64 `json:"crit,omitempty"`
+}
+
+var hwmonInput = regexp.MustCompile(`^(temp|fan|in|power)(\d+)_(input|average)$`)
+
+// hwmonScale converts raw sysfs units (m°C, RPM, mV, µW) to reported units.
+var hwmonScale = map[string]float64{
+	"temp":  1000,
+	"fan":   1,
+	"in":    1000,
+	"power": 1000000,
+}
+
+func readSensors() (*sensorsInfo, error) {
+	if !cfg.Sensors.Enabled {
+		return nil, nil
+	}
+	info := &sensorsInfo{}
+	readHwmon(info)
+	readThermalZones(info)
+	if len(info.Temperatures)+len(info.Fans)+len(info.Voltages)+len(info.Power) == 0 {
+		return nil, nil
+	}
+	return info, nil
+}
+
+type hwmonChip struct {
+	dir    string
+	name   string
+	device string
+}
+
+func readHwmon(info *sensorsInfo) {
+	entries, err := os.ReadDir(hwmonRoot)
+	if err != nil {
+		return
+	}
+
+	var chips []hwmonChip
+	names := map[string]int{}
+	for _, entry := range entries {
+		dir := filepath.Join(hwmonRoot, entry.Name())
+		// Older drivers keep their attributes under device/.
+		if _, err := os.Stat(filepath.Join(dir, "name")); err != nil {
+			dir = filepath.Join(dir, "device")
+		}
+		name := readSysfsString(filepath.Join(dir, "name"))
+		if name == "" {
+			continue
+		}
+		device := ""
+		if target, err := os.Readlink(filepath.Join(hwmonRoot, entry.Name(), "device")); err == nil {
+			device = filepath.Base(target)
+		}
+		// Thermal zones register a hwmon device too; they are read from the
+		// thermal class where their trip points are available.
+		if strings.HasPrefix(device, "thermal_zone") {
+			continue
+		}
+		chips = append(chips, hwmonChip{dir: dir, name: name, device: device})
+		names[name]++
+	}
+
+	for _, chip := range chips {
+		// Tell identical chips apart (e.g. two NVMe drives) by their device.
+		label := chip.name
+		if names[chip.name] > 1 && chip.device != "" {
+			label = chip.name + "-" + chip.device
+		}
+		readHwmonChip(info, chip.dir, label)
+	}
+
+	for _, list := range [][]sensorReading{info.Temperatures, info.Fans, info.Voltages, info.Power} {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Chip != list[j].Chip {
+				return list[i].Chip < list[j].Chip
+			}
+			return list[i].Label < list[j].Label
+		})
+	}
+}
+
+func readHwmonChip(info *sensorsInfo, dir, chip string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		match := hwmonInput.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		kind, prefix := match[1], match[1]+match[2]
+		// power sensors may expose both _input and _average.
+		if seen[prefix] {
+			continue
+		}
+		raw, ok := readSysfsFloat(filepath.Join(dir, entry.Name()))
+		if !ok {
+			continue
+		}
+		seen[prefix] = true
+
+		scale := hwmonScale[kind]
+		reading := sensorReading{
+			Chip:  chip,
+			Label: readSysfsString(filepath.Join(dir, prefix+"_label")),
+			Value: raw / scale,
+		}
+		if reading.Label == "" {
+			reading.Label = prefix
+		}
+		if v, ok := readSysfsFloat(filepath.Join(dir, prefix+"_min")); ok {
+			reading.Min = v / scale
+		}
+		if v, ok := readSysfsFloat(filepath.Join(dir, prefix+"_max")); ok {
+			reading.Max = v / scale
+		} else if v, ok := readSysfsFloat(filepath.Join(dir, prefix+"_cap")); ok {
+			reading.Max = v / scale
+		}
+		if v, ok := readSysfsFloat(filepath.Join(dir, prefix+"_crit")); ok {
+			reading.Crit = v / scale
+		}
+
+		switch kind {
+		case "temp":
+			info.Temperatures = append(info.Temperatures, reading)
+		case "fan":
+			info.Fans = append(info.Fans, reading)
+		case "in":
+			info.Voltages = append(info.Voltages, reading)
+		case "power":
+			info.Power = append(info.Power, reading)
+		}
+	}
+}
+
+func readThermalZones(info *sensorsInfo) {
+	zones, err := filepath.Glob(filepath.Join(thermalRoot, "thermal_zone*"))
+	if err != nil {
+		return
+	}
+	sort.Strings(zones)
+	for _, zone := range zones {
+		temp, ok := readSysfsFloat(filepath.Join(zone, "temp"))
+		if !ok {
+			continue
+		}
+		reading := sensorReading{
+			Chip:  filepath.Base(zone),
+			Label: readSysfsString(filepath.Join(zone, "type")),
+			Value: temp / 1000,
+		}
+		trips, _ := filepath.Glob(filepath.Join(zone, "trip_point_*_type"))
+		for _, trip := range trips {
+			tripTemp, ok := readSysfsFloat(strings.TrimSuffix(trip, "_type") + "_temp")
+			if !ok || tripTemp <= 0 {
+				continue
+			}
+			switch readSysfsString(trip) {
+			case "critical":
+				reading.Crit = tripTemp / 1000
+			case "hot":
+				reading.Max = tripTemp / 1000
+			}
+		}
+		info.Temperatures = append(info.Temperatures, reading)
+	}
+}
+
+func readSysfsString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readSysfsFloat(path string) (float64, bool) {
+	value := readSysfsString(path)
+	if value == "" {
+		return 0, false
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return parsed, true
+}
+
+func evaluateSensorsHealth(health *healthInfo, info *sensorsInfo) {
+	if info == nil {
+		return
+	}
+	for _, t := range info.Temperatures {
+		name := t.Chip + "/" + t.Label
+		switch {
+		case t.Crit > 0 && t.Value >= t.Crit:
+			health.degrade("critical", fmt.Sprintf("temperature %s at %.1f°C (crit %.0f°C)", name, t.Value, t.Crit))
+		case t.Crit > 0 && t.Value >= t.Crit-cfg.Sensors.CritMargin:
+			health.degrade("warning", fmt.Sprintf("temperature %s at %.1f°C approaching crit %.0f°C", name, t.Value, t.Crit))
+		case t.Max > 0 && t.Value >= t.Max:
+			health.degrade("warning", fmt.Sprintf("temperature %s at %.1f°C above max %.0f°C", name, t.Value, t.Max))
+		}
+	}
+}
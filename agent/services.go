@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type servicesConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+type serviceInfo struct {
+	Name            string        `json:"name"`
+	Cgroup          string        `json:"cgroup"`
+	CPUPercent      float64       `json:"cpu_percent,omitempty"`
+	MemoryCurrentMB float64       `json:"memory_current_mb,omitempty"`
+	MemoryMaxMB     float64       `json:"memory_max_mb,omitempty"`
+	OOMEvents       uint64        `json:"oom_events,omitempty"`
+	OOMKills        uint64        `json:"oom_kills,omitempty"`
+	IOReadBytes     uint64        `json:"io_read_bytes,omitempty"`
+	IOWriteBytes    uint64        `json:"io_write_bytes,omitempty"`
+	PIDs            uint64        `json:"pids,omitempty"`
+	Pressure        *pressureInfo `json:"pressure,omitempty"`
+}
+
+var serviceRates = newRateTracker()
+
+// readServices reports cgroup v2 usage for every systemd slice and service.
+// CPU usage is a rate between two collections, so the first one reports 0.
+func readServices() ([]serviceInfo, error) {
+	if !cfg.Services.Enabled {
+		return nil, nil
+	}
+	// Only the unified (v2) hierarchy has cgroup.controllers at its root.
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var result []serviceInfo
+	err := filepath.WalkDir(cgroupRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		isService := strings.HasSuffix(name, ".service")
+		if !isService && !strings.HasSuffix(name, ".slice") {
+			return nil
+		}
+		result = append(result, readServiceCgroup(path, now))
+		// A service's own sub-cgroups are accounted in the service itself.
+		if isService {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].MemoryCurrentMB != result[j].MemoryCurrentMB {
+			return result[i].MemoryCurrentMB > result[j].MemoryCurrentMB
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func readServiceCgroup(dir string, now time.Time) serviceInfo {
+	rel, _ := filepath.Rel(cgroupRoot, dir)
+	info := serviceInfo{
+		Name:   filepath.Base(dir),
+		Cgroup: "/" + rel,
+	}
+
+	usage := readCgroupKeyed(dir, "cpu.stat")["usage_usec"]
+	if rate, ok := serviceRates.rate(dir, usage, now); ok {
+		info.CPUPercent = rate / 1e6 * 100
+	}
+	if current, ok := readCgroupValue(dir, "memory.current"); ok {
+		info.MemoryCurrentMB = float64(current) / (1024.0 * 1024.0)
+	}
+	if limit, ok := readCgroupValue(dir, "memory.max"); ok {
+		info.MemoryMaxMB = float64(limit) / (1024.0 * 1024.0)
+	}
+	events := readCgroupKeyed(dir, "memory.events")
+	info.OOMEvents = events["oom"]
+	info.OOMKills = events["oom_kill"]
+	info.IOReadBytes, info.IOWriteBytes = readCgroupIO(dir)
+	info.PIDs, _ = readCgroupValue(dir, "pids.current")
+	info.Pressure = readCgroupPressure(dir)
+	return info
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// smartctl exit status bits 0 and 1 mean the command line or the device
+// open failed; the higher bits describe the disk and still come with JSON.
+// With -n standby, bit 1 is also how smartctl reports a sleeping drive.
+const (
+	smartctlFatalBits = 0x3
+	smartctlOpenBit   = 0x2
+)
+
+type smartConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Smartctl string   `json:"smartctl"`
+	Interval duration `json:"interval"`
+	// Devices overrides disk detection, e.g. ["/dev/sda", "/dev/nvme0"].
+	Devices []string `json:"devices"`
+}
+
+type smartDiskInfo struct {
+	Device             string  `json:"device"`
+	Model              string  `json:"model,omitempty"`
+	Serial             string  `json:"serial,omitempty"`
+	Protocol           string  `json:"protocol,omitempty"`
+	Passed             *bool   `json:"passed,omitempty"`
+	TemperatureC       int     `json:"temperature_c,omitempty"`
+	PowerOnHours       uint64  `json:"power_on_hours,omitempty"`
+	ReallocatedSectors *uint64 `json:"reallocated_sectors,omitempty"`
+	PendingSectors     *uint64 `json:"pending_sectors,omitempty"`
+	PercentageUsed     *uint64 `json:"percentage_used,omitempty"`
+	MediaErrors        *uint64 `json:"media_errors,omitempty"`
+	// Standby is set when the drive was asleep and smartctl left it alone.
+	Standby   bool   `json:"standby,omitempty"`
+	CheckedAt string `json:"checked_at"`
+	Error     string `json:"error,omitempty"`
+}
+
+// smartctlOutput is the subset of `smartctl --json -a` the agent reads.
+type smartctlOutput struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+		Messages   []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	Device struct {
+		Protocol string `json:"protocol"`
+	} `json:"device"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours uint64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATASmartAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value uint64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth *struct {
+		PercentageUsed uint64 `json:"percentage_used"`
+		MediaErrors    uint64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+// smartCache holds the last smartctl results. Running smartctl can take
+// seconds per disk and may wake sleeping drives, so it refreshes in the
+// background at most once per interval and requests read the cache.
+type smartCache struct {
+	mu        sync.Mutex
+	disks     []smartDiskInfo
+	refreshed time.Time
+	running   bool
+}
+
+var smart = &smartCache{}
+
+func readSmart() ([]smartDiskInfo, error) {
+	if !cfg.Smart.Enabled {
+		return nil, nil
+	}
+	smartctl, err := exec.LookPath(cfg.Smart.Smartctl)
+	if err != nil {
+		return nil, nil
+	}
+
+	smart.mu.Lock()
+	defer smart.mu.Unlock()
+	if !smart.running && time.Since(smart.refreshed) >= cfg.Smart.Interval.Duration {
+		smart.running = true
+		go smart.refresh(smartctl)
+	}
+	return append([]smartDiskInfo(nil), smart.disks...), nil
+}
+
+func (c *smartCache) refresh(smartctl string) {
+	devices := cfg.Smart.Devices
+	if len(devices) == 0 {
+		devices = detectSmartDevices()
+	}
+	disks := make([]smartDiskInfo, 0, len(devices))
+	for _, device := range devices {
+		disks = append(disks, readSmartDisk(smartctl, device))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disks = disks
+	c.refreshed = time.Now()
+	c.running = false
+}
+
+// detectSmartDevices lists whole physical disks from /sys/block, skipping
+// virtual, optical and device-mapper devices.
+func detectSmartDevices() []string {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+	var devices []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "sd") && !strings.HasPrefix(name, "nvme") &&
+			!strings.HasPrefix(name, "hd") && !strings.HasPrefix(name, "vd") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join("/sys/block", name, "device")); err != nil {
+			continue
+		}
+		devices = append(devices, "/dev/"+name)
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+func readSmartDisk(smartctl, device string) smartDiskInfo {
+	disk := smartDiskInfo{
+		Device:    device,
+		CheckedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	// -n standby keeps smartctl from spinning up a sleeping drive. A non-zero
+	// exit is normal for disks with logged errors; judge by the JSON.
+	out, runErr := exec.CommandContext(ctx, smartctl, "--json", "-n", "standby", "-a", device).Output()
+	parseSmartctl(&disk, out, runErr)
+	return disk
+}
+
+// parseSmartctl fills disk from the JSON output of smartctl; runErr is
+// reported when the output is not JSON at all.
+func parseSmartctl(disk *smartDiskInfo, out []byte, runErr error) {
+	var parsed smartctlOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		if runErr != nil {
+			disk.Error = runErr.Error()
+		} else {
+			disk.Error = fmt.Sprintf("parse smartctl output: %v", err)
+		}
+		return
+	}
+	if parsed.Smartctl.ExitStatus&smartctlOpenBit != 0 {
+		for _, msg := range parsed.Smartctl.Messages {
+			lower := strings.ToLower(msg.String)
+			if strings.Contains(lower, "standby mode") || strings.Contains(lower, "sleep mode") {
+				disk.Standby = true
+				return
+			}
+		}
+	}
+	if parsed.Smartctl.ExitStatus&smartctlFatalBits != 0 {
+		disk.Error = fmt.Sprintf("smartctl exit status %d", parsed.Smartctl.ExitStatus)
+		for _, msg := range parsed.Smartctl.Messages {
+			if msg.Severity == "error" {
+				disk.Error = msg.String
+				break
+			}
+		}
+		return
+	}
+
+	disk.Model = parsed.ModelName
+	disk.Serial = parsed.SerialNumber
+	disk.Protocol = parsed.Device.Protocol
+	if parsed.SmartStatus != nil {
+		passed := parsed.SmartStatus.Passed
+		disk.Passed = &passed
+	}
+	disk.TemperatureC = parsed.Temperature.Current
+	disk.PowerOnHours = parsed.PowerOnTime.Hours
+	for _, attr := range parsed.ATASmartAttributes.Table {
+		raw := attr.Raw.Value
+		switch attr.ID {
+		case 5:
+			disk.ReallocatedSectors = &raw
+		case 197:
+			disk.PendingSectors = &raw
+		}
+	}
+	if nvme := parsed.NVMeHealth; nvme != nil {
+		disk.PercentageUsed = &nvme.PercentageUsed
+		disk.MediaErrors = &nvme.MediaErrors
+	}
+}
+
+func evaluateSmartHealth(health *healthInfo, disks []smartDiskInfo) {
+	for _, disk := range disks {
+		if disk.Passed != nil && !*disk.Passed {
+			health.degrade("critical", fmt.Sprintf("disk %s failed SMART self-assessment", disk.Device))
+			continue
+		}
+		if disk.PendingSectors != nil && *disk.PendingSectors > 0 {
+			health.degrade("warning", fmt.Sprintf("disk %s has %d pending sectors", disk.Device, *disk.PendingSectors))
+		}
+		if disk.MediaErrors != nil && *disk.MediaErrors > 0 {
+			health.degrade("warning", fmt.Sprintf("disk %s has %d media errors", disk.Device, *disk.MediaErrors))
+		}
+		if disk.PercentageUsed != nil && *disk.PercentageUsed >= 100 {
+			health.degrade("warning", fmt.Sprintf("disk %s has used %d%% of its rated endurance", disk.Device, *disk.PercentageUsed))
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSmartctl(t *testing.T) {
+	passed, failed := true, false
+	u64 := func(v uint64) *uint64 { return &v }
+
+	tests := []struct {
+		fixture string
+		want    smartDiskInfo
+		status  string
+		reasons []string
+	}{
+		{
+			fixture: "smartctl_sata_healthy.json",
+			want: smartDiskInfo{
+				Model: "Samsung SSD 870 EVO 1TB", Serial: "S6PTNM0T123456A", Protocol: "ATA",
+				Passed: &passed, TemperatureC: 33, PowerOnHours: 8123,
+				ReallocatedSectors: u64(0), PendingSectors: u64(0),
+			},
+			status: "ok",
+		},
+		{
+			fixture: "smartctl_nvme.json",
+			want: smartDiskInfo{
+				Model: "WD_BLACK SN850X 2000GB", Serial: "23123A800123", Protocol: "NVMe",
+				Passed: &passed, TemperatureC: 41, PowerOnHours: 3021,
+				PercentageUsed: u64(2), MediaErrors: u64(0),
+			},
+			status: "ok",
+		},
+		{
+			// Exit status 24 sets the disk-failing and prefail bits, which
+			// still come with readings.
+			fixture: "smartctl_sata_failing.json",
+			want: smartDiskInfo{
+				Model: "WDC WD40EFRX-68N32N0", Serial: "WD-WCC7K1234567", Protocol: "ATA",
+				Passed: &failed, TemperatureC: 38, PowerOnHours: 46890,
+				ReallocatedSectors: u64(1832), PendingSectors: u64(24),
+			},
+			status:  "critical",
+			reasons: []string{"disk /dev/test failed SMART self-assessment"},
+		},
+		{
+			fixture: "smartctl_standby.json",
+			want:    smartDiskInfo{Standby: true},
+			status:  "ok",
+		},
+		{
+			fixture: "smartctl_missing.json",
+			want:    smartDiskInfo{Error: "Smartctl open device: /dev/sdz failed: No such device"},
+			status:  "ok",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSuffix(tt.fixture, ".json"), func(t *testing.T) {
+			out, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			disk := smartDiskInfo{Device: "/dev/test"}
+			parseSmartctl(&disk, out, nil)
+			tt.want.Device = "/dev/test"
+			if !reflect.DeepEqual(disk, tt.want) {
+				t.Errorf("parseSmartctl\n got %+v\nwant %+v", disk, tt.want)
+			}
+
+			health := healthInfo{Status: "ok"}
+			evaluateSmartHealth(&health, []smartDiskInfo{disk})
+			if health.Status != tt.status {
+				t.Errorf("status = %s, want %s", health.Status, tt.status)
+			}
+			if strings.Join(health.Reasons, "; ") != strings.Join(tt.reasons, "; ") {
+				t.Errorf("reasons = %q, want %q", health.Reasons, tt.reasons)
+			}
+		})
+	}
+}
+
+func TestParseSmartctlNotJSON(t *testing.T) {
+	var disk smartDiskInfo
+	parseSmartctl(&disk, nil, errors.New("exit status 1"))
+	if disk.Error != "exit status 1" {
+		t.Errorf("error = %q, want the run error", disk.Error)
+	}
+
+	disk = smartDiskInfo{}
+	parseSmartctl(&disk, []byte("smartctl 6.6"), nil)
+	if !strings.HasPrefix(disk.Error, "parse smartctl output:") {
+		t.Errorf("error = %q, want a parse error", disk.Error)
+	}
+}
+
+func TestEvaluateSmartHealthWear(t *testing.T) {
+	used, errs := uint64(100), uint64(3)
+	health := healthInfo{Status: "ok"}
+	evaluateSmartHealth(&health, []smartDiskInfo{{Device: "/dev/nvme0", PercentageUsed: &used, MediaErrors: &errs}})
+	want := []string{
+		"disk /dev/nvme0 has 3 media errors",
+		"disk /dev/nvme0 has used 100% of its rated endurance",
+	}
+	if health.Status != "warning" || !reflect.DeepEqual(health.Reasons, want) {
+		t.Errorf("health = %+v, want warning with %q", health, want)
+	}
+}
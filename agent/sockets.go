@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type socketsConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+type socketsInfo struct {
+	Used      int                `json:"used"`
+	TCP       tcpSocketsInfo     `json:"tcp"`
+	UDP       udpSocketsInfo     `json:"udp"`
+	TCPStates map[string]int     `json:"tcp_states"`
+	Counters  map[string]uint64  `json:"counters"`
+	Rates     map[string]float64 `json:"rates,omitempty"`
+	// TCPRetransmitPercent is retransmitted segments as a share of segments
+	// sent since the previous collection.
+	TCPRetransmitPercent float64 `json:"tcp_retransmit_percent,omitempty"`
+}
+
+type tcpSocketsInfo struct {
+	InUse    int `json:"inuse"`
+	InUse6   int `json:"inuse6"`
+	Orphan   int `json:"orphan"`
+	TimeWait int `json:"time_wait"`
+	Alloc    int `json:"alloc"`
+	MemPages int `json:"mem_pages"`
+}
+
+type udpSocketsInfo struct {
+	InUse    int `json:"inuse"`
+	InUse6   int `json:"inuse6"`
+	MemPages int `json:"mem_pages"`
+}
+
+// tcpStates names the st column of /proc/net/tcp (include/net/tcp_states.h).
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+	"0C": "NEW_SYN_RECV",
+}
+
+// socketCounters picks counters from /proc/net/snmp and /proc/net/netstat
+// by section and field, reported under the given name.
+var socketCounters = []struct {
+	section, field, name string
+}{
+	{"Tcp", "ActiveOpens", "tcp_active_opens"},
+	{"Tcp", "PassiveOpens", "tcp_passive_opens"},
+	{"Tcp", "AttemptFails", "tcp_attempt_fails"},
+	{"Tcp", "EstabResets", "tcp_estab_resets"},
+	{"Tcp", "InSegs", "tcp_in_segs"},
+	{"Tcp", "OutSegs", "tcp_out_segs"},
+	{"Tcp", "RetransSegs", "tcp_retrans_segs"},
+	{"Tcp", "InErrs", "tcp_in_errs"},
+	{"Tcp", "OutRsts", "tcp_out_rsts"},
+	{"TcpExt", "ListenOverflows", "tcp_listen_overflows"},
+	{"TcpExt", "ListenDrops", "tcp_listen_drops"},
+	{"TcpExt", "TCPTimeouts", "tcp_timeouts"},
+	{"TcpExt", "TCPAbortOnData", "tcp_abort_on_data"},
+	{"TcpExt", "TCPAbortOnTimeout", "tcp_abort_on_timeout"},
+	{"Udp", "InDatagrams", "udp_in_datagrams"},
+	{"Udp", "OutDatagrams", "udp_out_datagrams"},
+	{"Udp", "NoPorts", "udp_no_ports"},
+	{"Udp", "InErrors", "udp_in_errors"},
+	{"Udp", "RcvbufErrors", "udp_rcvbuf_errors"},
+	{"Udp", "SndbufErrors", "udp_sndbuf_errors"},
+}
+
+// SNMP counters are unsigned long, 32 bits wide on 32-bit kernels.
+var socketRates = &rateTracker{samples: make(map[string]rateSample), wrap32: true}
+
+func readSockets() (*socketsInfo, error) {
+	if !cfg.Sockets.Enabled {
+		return nil, nil
+	}
+	stat, err := readProcKeyedFile("/proc/net/sockstat")
+	if err != nil {
+		return nil, err
+	}
+	// sockstat6 is missing when IPv6 is disabled.
+	stat6, _ := readProcKeyedFile("/proc/net/sockstat6")
+
+	info := &socketsInfo{
+		Used: int(stat["sockets"]["used"]),
+		TCP: tcpSocketsInfo{
+			InUse:    int(stat["TCP"]["inuse"]),
+			InUse6:   int(stat6["TCP6"]["inuse"]),
+			Orphan:   int(stat["TCP"]["orphan"]),
+			TimeWait: int(stat["TCP"]["tw"]),
+			Alloc:    int(stat["TCP"]["alloc"]),
+			MemPages: int(stat["TCP"]["mem"]),
+		},
+		UDP: udpSocketsInfo{
+			InUse:    int(stat["UDP"]["inuse"]),
+			InUse6:   int(stat6["UDP6"]["inuse"]),
+			MemPages: int(stat["UDP"]["mem"]),
+		},
+		TCPStates: map[string]int{},
+		Counters:  map[string]uint64{},
+		Rates:     map[string]float64{},
+	}
+
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		if err := countTCPStates(path, info.TCPStates); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	snmp, err := readProcTableFile("/proc/net/snmp")
+	if err != nil {
+		return nil, err
+	}
+	netstat, _ := readProcTableFile("/proc/net/netstat")
+	for section, values := range netstat {
+		snmp[section] = values
+	}
+	now := time.Now()
+	for _, c := range socketCounters {
+		value, ok := snmp[c.section][c.field]
+		if !ok {
+			continue
+		}
+		info.Counters[c.name] = value
+		if rate, ok := socketRates.rate(c.name, value, now); ok {
+			info.Rates[c.name] = rate
+		}
+	}
+	if out := info.Rates["tcp_out_segs"]; out > 0 {
+		info.TCPRetransmitPercent = percent(info.Rates["tcp_retrans_segs"], out)
+	}
+	return info, nil
+}
+
+// readProcKeyedFile parses sockstat-style lines: "TCP: inuse 7 orphan 0".
+func readProcKeyedFile(path string) (map[string]map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]map[string]uint64{}
+	for _, line := range strings.Split(string(data), "\n") {
+		section, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		values := map[string]uint64{}
+		for i := 0; i+1 < len(fields); i += 2 {
+			values[fields[i]], _ = strconv.ParseUint(fields[i+1], 10, 64)
+		}
+		result[section] = values
+	}
+	return result, nil
+}
+
+// readProcTableFile parses snmp/netstat files, where each section is a
+// header line of field names followed by a line of values.
+func readProcTableFile(path string) (map[string]map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]map[string]uint64{}
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		section, header, ok1 := strings.Cut(lines[i], ":")
+		valueSection, row, ok2 := strings.Cut(lines[i+1], ":")
+		if !ok1 || !ok2 || section != valueSection {
+			return nil, fmt.Errorf("unexpected %s format", path)
+		}
+		names, values := strings.Fields(header), strings.Fields(row)
+		parsed := map[string]uint64{}
+		for j := 0; j < len(names) && j < len(values); j++ {
+			// Some fields (e.g. Tcp MaxConn) are signed; they parse as 0.
+			parsed[names[j]], _ = strconv.ParseUint(values[j], 10, 64)
+		}
+		result[section] = parsed
+	}
+	return result, nil
+}
+
+func countTCPStates(path string, states map[string]int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		if name, ok := tcpStates[fields[3]]; ok {
+			states[name]++
+		}
+	}
+	return scanner.Err()
+}
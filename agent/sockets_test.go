@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadProcTableFile(t *testing.T) {
+	snmp, err := readProcTableFile(filepath.Join("testdata", "proc_net_snmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	netstat, err := readProcTableFile(filepath.Join("testdata", "proc_net_netstat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		table          map[string]map[string]uint64
+		section, field string
+		want           uint64
+	}{
+		{snmp, "Tcp", "ActiveOpens", 143},
+		{snmp, "Tcp", "RetransSegs", 18},
+		{snmp, "Tcp", "OutRsts", 81},
+		// MaxConn is -1 and parses as 0.
+		{snmp, "Tcp", "MaxConn", 0},
+		{snmp, "Udp", "NoPorts", 4},
+		{snmp, "Udp", "OutDatagrams", 39},
+		{snmp, "IcmpMsg", "OutType3", 4},
+		{netstat, "TcpExt", "ListenOverflows", 5},
+		{netstat, "TcpExt", "TCPAbortOnData", 17},
+		{netstat, "IpExt", "InOctets", 125553910},
+	}
+	for _, tt := range tests {
+		values, ok := tt.table[tt.section]
+		if !ok {
+			t.Errorf("section %s missing", tt.section)
+			continue
+		}
+		if got, ok := values[tt.field]; !ok || got != tt.want {
+			t.Errorf("%s %s = %d (present %v), want %d", tt.section, tt.field, got, ok, tt.want)
+		}
+	}
+	if len(snmp) != 6 {
+		t.Errorf("snmp has %d sections, want 6", len(snmp))
+	}
+}
+
+func TestReadProcTableFileMismatchedSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snmp")
+	if err := os.WriteFile(path, []byte("Tcp: InSegs OutSegs\nUdp: 1 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readProcTableFile(path); err == nil {
+		t.Error("expected an error for a header without its value line")
+	}
+}
+
+func TestReadProcKeyedFile(t *testing.T) {
+	stat, err := readProcKeyedFile(filepath.Join("testdata", "proc_net_sockstat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]uint64{
+		"sockets": {"used": 18},
+		"TCP":     {"inuse": 4, "orphan": 0, "tw": 0, "alloc": 4, "mem": 0},
+		"UDP":     {"inuse": 0, "mem": 0},
+		"UDPLITE": {"inuse": 0},
+		"RAW":     {"inuse": 0},
+		"FRAG":    {"inuse": 0, "memory": 0},
+	}
+	if !reflect.DeepEqual(stat, want) {
+		t.Errorf("sockstat\n got %v\nwant %v", stat, want)
+	}
+
+	stat6, err := readProcKeyedFile(filepath.Join("testdata", "proc_net_sockstat6"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat6["TCP6"]["inuse"] != 3 || stat6["UDP6"]["inuse"] != 2 {
+		t.Errorf("sockstat6 = %v", stat6)
+	}
+}
+
+func TestCountTCPStates(t *testing.T) {
+	states := map[string]int{}
+	if err := countTCPStates(filepath.Join("testdata", "proc_net_tcp"), states); err != nil {
+		t.Fatal(err)
+	}
+	// The counts accumulate across files, as for tcp and tcp6.
+	if err := countTCPStates(filepath.Join("testdata", "proc_net_tcp"), states); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"LISTEN": 4, "ESTABLISHED": 4, "TIME_WAIT": 2, "CLOSE_WAIT": 2}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("states = %v, want %v", states, want)
+	}
+
+	if err := countTCPStates(filepath.Join(t.TempDir(), "tcp6"), states); !os.IsNotExist(err) {
+		t.Errorf("missing file error = %v", err)
+	}
+}
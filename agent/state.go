@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// readState loads a JSON document persisted under cfg.StateDir.
+func readState(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(cfg.StateDir, name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeState persists v under cfg.StateDir, replacing the file atomically.
+func writeState(name string, v interface{}) error {
+	if err := os.MkdirAll(cfg.StateDir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(cfg.StateDir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func removeState(name string) error {
+	err := os.Remove(filepath.Join(cfg.StateDir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
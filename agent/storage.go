@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mdstatPath   = "/proc/mdstat"
+	zfsKstatRoot = "/proc/spl/kstat/zfs"
+	btrfsRoot    = "/sys/fs/btrfs"
+)
+
+type storageConfig struct {
+	Enabled bool   `json:"enabled"`
+	Zpool   string `json:"zpool"`
+}
+
+type storageInfo struct {
+	Raid  []mdArrayInfo `json:"raid,omitempty"`
+	ZFS   []zfsPoolInfo `json:"zfs,omitempty"`
+	Btrfs []btrfsInfo   `json:"btrfs,omitempty"`
+}
+
+type mdArrayInfo struct {
+	Name          string      `json:"name"`
+	State         string      `json:"state"`
+	Level         string      `json:"level,omitempty"`
+	Devices       []string    `json:"devices"`
+	FailedDevices []string    `json:"failed_devices,omitempty"`
+	SpareDevices  []string    `json:"spare_devices,omitempty"`
+	RaidDisks     int         `json:"raid_disks,omitempty"`
+	ActiveDisks   int         `json:"active_disks,omitempty"`
+	Status        string      `json:"status,omitempty"`
+	Degraded      bool        `json:"degraded"`
+	Sync          *mdSyncInfo `json:"sync,omitempty"`
+}
+
+type mdSyncInfo struct {
+	Action        string  `json:"action"`
+	Percent       float64 `json:"percent"`
+	FinishMinutes float64 `json:"finish_minutes,omitempty"`
+	SpeedKBps     uint64  `json:"speed_kbps,omitempty"`
+}
+
+type zfsPoolInfo struct {
+	Name                 string   `json:"name"`
+	State                string   `json:"state"`
+	SizeBytes            uint64   `json:"size_bytes,omitempty"`
+	AllocBytes           uint64   `json:"alloc_bytes,omitempty"`
+	FreeBytes            uint64   `json:"free_bytes,omitempty"`
+	CapacityPercent      float64  `json:"capacity_percent,omitempty"`
+	FragmentationPercent float64  `json:"fragmentation_percent,omitempty"`
+	ReadErrors           uint64   `json:"read_errors"`
+	WriteErrors          uint64   `json:"write_errors"`
+	ChecksumErrors       uint64   `json:"checksum_errors"`
+	UnhealthyVdevs       []string `json:"unhealthy_vdevs,omitempty"`
+	Scan                 string   `json:"scan,omitempty"`
+	Errors               string   `json:"errors,omitempty"`
+}
+
+type btrfsInfo struct {
+	UUID    string            `json:"uuid"`
+	Label   string            `json:"label,omitempty"`
+	Devices []btrfsDeviceInfo `json:"devices"`
+}
+
+type btrfsDeviceInfo struct {
+	ID               string `json:"id"`
+	Missing          bool   `json:"missing,omitempty"`
+	WriteErrors      uint64 `json:"write_errors"`
+	ReadErrors       uint64 `json:"read_errors"`
+	FlushErrors      uint64 `json:"flush_errors"`
+	CorruptionErrors uint64 `json:"corruption_errors"`
+	GenerationErrors uint64 `json:"generation_errors"`
+}
+
+func readStorage() (*storageInfo, error) {
+	if !cfg.Storage.Enabled {
+		return nil, nil
+	}
+	info := &storageInfo{}
+	var errs []string
+	var err error
+	if info.Raid, err = readMdstat(mdstatPath); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err.Error())
+	}
+	if info.ZFS, err = readZFSPools(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	info.Btrfs = readBtrfs()
+	if len(info.Raid)+len(info.ZFS)+len(info.Btrfs) == 0 {
+		info = nil
+	}
+	if len(errs) > 0 {
+		return info, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return info, nil
+}
+
+var (
+	mdArrayLine  = regexp.MustCompile(`^(md\S+)\s*:\s*(.*)$`)
+	mdMember     = regexp.MustCompile(`^(\S+)\[\d+\](\([A-Z]\))*$`)
+	mdDiskCounts = regexp.MustCompile(`\[(\d+)/(\d+)\]\s+\[([U_]+)\]`)
+	mdSyncLine   = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*([\d.]+)%`)
+	mdSyncFinish = regexp.MustCompile(`finish=([\d.]+)min`)
+	mdSyncSpeed  = regexp.MustCompile(`speed=(\d+)K/sec`)
+)
+
+// readMdstat parses /proc/mdstat. Each array starts with "mdN : state level
+// members" and continues on indented lines until the next blank line.
+func readMdstat(path string) ([]mdArrayInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var arrays []mdArrayInfo
+	var current *mdArrayInfo
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := mdArrayLine.FindStringSubmatch(line); match != nil {
+			arrays = append(arrays, parseMdArrayLine(match[1], match[2]))
+			current = &arrays[len(arrays)-1]
+			continue
+		}
+		if current == nil || strings.TrimSpace(line) == "" {
+			current = nil
+			continue
+		}
+		if match := mdDiskCounts.FindStringSubmatch(line); match != nil {
+			current.RaidDisks, _ = strconv.Atoi(match[1])
+			current.ActiveDisks, _ = strconv.Atoi(match[2])
+			current.Status = match[3]
+		}
+		if match := mdSyncLine.FindStringSubmatch(line); match != nil {
+			progress := &mdSyncInfo{Action: match[1]}
+			progress.Percent, _ = strconv.ParseFloat(match[2], 64)
+			if m := mdSyncFinish.FindStringSubmatch(line); m != nil {
+				progress.FinishMinutes, _ = strconv.ParseFloat(m[1], 64)
+			}
+			if m := mdSyncSpeed.FindStringSubmatch(line); m != nil {
+				progress.SpeedKBps, _ = strconv.ParseUint(m[1], 10, 64)
+			}
+			current.Sync = progress
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range arrays {
+		a := &arrays[i]
+		a.Degraded = len(a.FailedDevices) > 0 ||
+			(a.RaidDisks > 0 && a.ActiveDisks < a.RaidDisks)
+	}
+	return arrays, nil
+}
+
+func parseMdArrayLine(name, rest string) mdArrayInfo {
+	array := mdArrayInfo{Name: name, Devices: []string{}}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return array
+	}
+	array.State = fields[0]
+	fields = fields[1:]
+	// "(read-only)" and "(auto-read-only)" qualify the state.
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "(") {
+		array.State += " " + fields[0]
+		fields = fields[1:]
+	}
+	for _, field := range fields {
+		match := mdMember.FindStringSubmatch(field)
+		if match == nil {
+			if array.Level == "" {
+				array.Level = field
+			}
+			continue
+		}
+		array.Devices = append(array.Devices, match[1])
+		switch {
+		case strings.Contains(field, "(F)"):
+			array.FailedDevices = append(array.FailedDevices, match[1])
+		case strings.Contains(field, "(S)"):
+			array.SpareDevices = append(array.SpareDevices, match[1])
+		}
+	}
+	return array
+}
+
+// readZFSPools takes pool health from the SPL kstats, which is cheap and
+// never blocks, and capacity and vdev errors from the zpool command when it
+// is installed.
+func readZFSPools() ([]zfsPoolInfo, error) {
+	entries, err := os.ReadDir(zfsKstatRoot)
+	if err != nil {
+		return nil, nil
+	}
+	var pools []zfsPoolInfo
+	byName := map[string]int{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		state := readSysfsString(filepath.Join(zfsKstatRoot, entry.Name(), "state"))
+		if state == "" {
+			continue
+		}
+		byName[entry.Name()] = len(pools)
+		pools = append(pools, zfsPoolInfo{Name: entry.Name(), State: state})
+	}
+	if len(pools) == 0 {
+		return nil, nil
+	}
+
+	zpool, err := exec.LookPath(cfg.Storage.Zpool)
+	if err != nil {
+		return pools, nil
+	}
+	list, err := runZpool(zpool, "list", "-Hp", "-o", "name,size,alloc,free,frag,cap")
+	if err != nil {
+		return pools, err
+	}
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 6 {
+			continue
+		}
+		i, ok := byName[fields[0]]
+		if !ok {
+			continue
+		}
+		pools[i].SizeBytes, _ = strconv.ParseUint(fields[1], 10, 64)
+		pools[i].AllocBytes, _ = strconv.ParseUint(fields[2], 10, 64)
+		pools[i].FreeBytes, _ = strconv.ParseUint(fields[3], 10, 64)
+		pools[i].FragmentationPercent, _ = strconv.ParseFloat(strings.TrimSuffix(fields[4], "%"), 64)
+		pools[i].CapacityPercent, _ = strconv.ParseFloat(strings.TrimSuffix(fields[5], "%"), 64)
+	}
+
+	status, err := runZpool(zpool, "status", "-p")
+	if err != nil {
+		return pools, err
+	}
+	parseZpoolStatus(status, pools, byName)
+	return pools, nil
+}
+
+func runZpool(zpool string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, zpool, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("zpool %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// zpoolRow is one NAME STATE READ WRITE CKSUM row of the config section.
+type zpoolRow struct {
+	indent             int
+	name, state        string
+	read, write, cksum uint64
+}
+
+// parseZpoolStatus adds vdev error counters, the scan line and the errors
+// summary from `zpool status -p` to the matching pools. Errors are summed
+// over leaf devices only: a mirror or raidz row repeats the counts of the
+// disks below it.
+func parseZpoolStatus(status string, pools []zfsPoolInfo, byName map[string]int) {
+	var pool *zfsPoolInfo
+	var pending *zpoolRow
+	// flush accounts the buffered row once the next one shows whether it
+	// has children.
+	flush := func(next *zpoolRow) {
+		if pending != nil && pool != nil {
+			if next == nil || next.indent <= pending.indent {
+				pool.ReadErrors += pending.read
+				pool.WriteErrors += pending.write
+				pool.ChecksumErrors += pending.cksum
+			}
+		}
+		pending = next
+	}
+
+	inConfig := false
+	for _, line := range strings.Split(status, "\n") {
+		trimmed := strings.TrimSpace(line)
+		key, value, _ := strings.Cut(trimmed, ":")
+		switch key {
+		case "pool":
+			flush(nil)
+			pool = nil
+			if i, ok := byName[strings.TrimSpace(value)]; ok {
+				pool = &pools[i]
+			}
+			inConfig = false
+			continue
+		case "scan":
+			if pool != nil {
+				pool.Scan = strings.TrimSpace(value)
+			}
+			continue
+		case "config":
+			inConfig = true
+			continue
+		case "errors":
+			flush(nil)
+			if pool != nil {
+				pool.Errors = strings.TrimSpace(value)
+			}
+			inConfig = false
+			continue
+		}
+		if pool == nil || !inConfig {
+			continue
+		}
+
+		// NAME STATE READ WRITE CKSUM [note]
+		fields := strings.Fields(trimmed)
+		if len(fields) < 5 || fields[0] == "NAME" {
+			continue
+		}
+		row := &zpoolRow{
+			indent: len(line) - len(strings.TrimLeft(line, " \t")),
+			name:   fields[0],
+			state:  fields[1],
+		}
+		var err1, err2, err3 error
+		row.read, err1 = strconv.ParseUint(fields[2], 10, 64)
+		row.write, err2 = strconv.ParseUint(fields[3], 10, 64)
+		row.cksum, err3 = strconv.ParseUint(fields[4], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		flush(row)
+		if row.name != pool.Name && row.state != "ONLINE" && row.state != "AVAIL" && row.state != "INUSE" {
+			pool.UnhealthyVdevs = append(pool.UnhealthyVdevs, row.name+" "+row.state)
+		}
+	}
+	flush(nil)
+}
+
+// readBtrfs reports per-device error counters and missing devices for every
+// mounted Btrfs filesystem. error_stats needs Linux 5.14 or newer.
+func readBtrfs() []btrfsInfo {
+	entries, err := os.ReadDir(btrfsRoot)
+	if err != nil {
+		return nil
+	}
+	var result []btrfsInfo
+	for _, entry := range entries {
+		fsDir := filepath.Join(btrfsRoot, entry.Name())
+		devices, err := os.ReadDir(filepath.Join(fsDir, "devinfo"))
+		if err != nil {
+			continue
+		}
+		fs := btrfsInfo{
+			UUID:    entry.Name(),
+			Label:   readSysfsString(filepath.Join(fsDir, "label")),
+			Devices: []btrfsDeviceInfo{},
+		}
+		for _, device := range devices {
+			devDir := filepath.Join(fsDir, "devinfo", device.Name())
+			dev := btrfsDeviceInfo{
+				ID:      device.Name(),
+				Missing: readSysfsString(filepath.Join(devDir, "missing")) == "1",
+			}
+			stats := readSysfsString(filepath.Join(devDir, "error_stats"))
+			for _, line := range strings.Split(stats, "\n") {
+				fields := strings.Fields(line)
+				if len(fields) != 2 {
+					continue
+				}
+				value, _ := strconv.ParseUint(fields[1], 10, 64)
+				switch fields[0] {
+				case "write_errs":
+					dev.WriteErrors = value
+				case "read_errs":
+					dev.ReadErrors = value
+				case "flush_errs":
+					dev.FlushErrors = value
+				case "corruption_errs":
+					dev.CorruptionErrors = value
+				case "generation_errs":
+					dev.GenerationErrors = value
+				}
+			}
+			fs.Devices = append(fs.Devices, dev)
+		}
+		sort.Slice(fs.Devices, func(i, j int) bool {
+			a, _ := strconv.Atoi(fs.Devices[i].ID)
+			b, _ := strconv.Atoi(fs.Devices[j].ID)
+			return a < b
+		})
+		result = append(result, fs)
+	}
+	return result
+}
+
+func evaluateStorageHealth(health *healthInfo, info *storageInfo) {
+	if info == nil {
+		return
+	}
+	for _, a := range info.Raid {
+		switch {
+		case a.Degraded:
+			health.degrade("critical", fmt.Sprintf("RAID array %s degraded [%s]", a.Name, a.Status))
+		case a.State == "inactive":
+			health.degrade("warning", fmt.Sprintf("RAID array %s inactive", a.Name))
+		}
+	}
+	for _, p := range info.ZFS {
+		switch {
+		case p.State != "ONLINE":
+			health.degrade("critical", fmt.Sprintf("ZFS pool %s %s", p.Name, p.State))
+		case p.ReadErrors+p.WriteErrors+p.ChecksumErrors > 0:
+			health.degrade("warning", fmt.Sprintf("ZFS pool %s has %d read, %d write and %d checksum errors",
+				p.Name, p.ReadErrors, p.WriteErrors, p.ChecksumErrors))
+		}
+	}
+	for _, fs := range info.Btrfs {
+		name := fs.Label
+		if name == "" {
+			name = fs.UUID
+		}
+		for _, dev := range fs.Devices {
+			errors := dev.WriteErrors + dev.ReadErrors + dev.FlushErrors + dev.CorruptionErrors + dev.GenerationErrors
+			switch {
+			case dev.Missing:
+				health.degrade("critical", fmt.Sprintf("Btrfs %s device %s missing", name, dev.ID))
+			case errors > 0:
+				health.degrade("warning", fmt.Sprintf("Btrfs %s device %s has %d errors", name, dev.ID, errors))
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseMdArrayLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want mdArrayInfo
+	}{
+		{"active raid1 sdb1[1] sda1[0]", mdArrayInfo{
+			Name: "md0", State: "active", Level: "raid1", Devices: []string{"sdb1", "sda1"},
+		}},
+		{"active raid1 sdb1[1](F) sda1[0]", mdArrayInfo{
+			Name: "md0", State: "active", Level: "raid1", Devices: []string{"sdb1", "sda1"},
+			FailedDevices: []string{"sdb1"},
+		}},
+		{"active (auto-read-only) raid1 sdd1[1] sde1[2](S)", mdArrayInfo{
+			Name: "md0", State: "active (auto-read-only)", Level: "raid1", Devices: []string{"sdd1", "sde1"},
+			SpareDevices: []string{"sde1"},
+		}},
+		{"inactive sdc[0](S)", mdArrayInfo{
+			Name: "md0", State: "inactive", Devices: []string{"sdc"}, SpareDevices: []string{"sdc"},
+		}},
+		{"", mdArrayInfo{Name: "md0", Devices: []string{}}},
+	}
+	for _, tt := range tests {
+		if got := parseMdArrayLine("md0", tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMdArrayLine(%q)\n got %+v\nwant %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestReadMdstat(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []mdArrayInfo
+	}{
+		{"mdstat_degraded", []mdArrayInfo{
+			{
+				Name: "md1", State: "active", Level: "raid1", Devices: []string{"sdb1", "sda1"},
+				FailedDevices: []string{"sdb1"}, RaidDisks: 2, ActiveDisks: 1, Status: "U_", Degraded: true,
+			},
+			{
+				Name: "md0", State: "active (auto-read-only)", Level: "raid1", Devices: []string{"sdd1", "sdc1", "sde1"},
+				SpareDevices: []string{"sde1"}, RaidDisks: 2, ActiveDisks: 2, Status: "UU",
+			},
+		}},
+		{"mdstat_resync", []mdArrayInfo{
+			{
+				Name: "md127", State: "active", Level: "raid5", Devices: []string{"sdd", "sdc", "sdb"},
+				RaidDisks: 3, ActiveDisks: 2, Status: "UU_", Degraded: true,
+				Sync: &mdSyncInfo{Action: "recovery", Percent: 28.4, FinishMinutes: 61.2, SpeedKBps: 190214},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := readMdstat(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readMdstat\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseZpoolStatus(t *testing.T) {
+	status, err := os.ReadFile(filepath.Join("testdata", "zpool_status_p.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools := []zfsPoolInfo{{Name: "tank", State: "DEGRADED"}, {Name: "backup", State: "ONLINE"}}
+	parseZpoolStatus(string(status), pools, map[string]int{"tank": 0, "backup": 1})
+
+	want := []zfsPoolInfo{
+		{
+			Name: "tank", State: "DEGRADED",
+			// Leaf devices only: sdb, sdc, sdd and the log device.
+			ReadErrors: 3, WriteErrors: 3, ChecksumErrors: 9,
+			UnhealthyVdevs: []string{"mirror-0 DEGRADED", "sdb FAULTED"},
+			Scan:           "scrub repaired 0B in 01:02:03 with 0 errors on Sun Jun  2 03:02:03 2024",
+			Errors:         "No known data errors",
+		},
+		{
+			Name: "backup", State: "ONLINE", ChecksumErrors: 5,
+			Scan: "none requested", Errors: "No known data errors",
+		},
+	}
+	if !reflect.DeepEqual(pools, want) {
+		t.Errorf("parseZpoolStatus\n got %+v\nwant %+v", pools, want)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	systemdDest    = "org.freedesktop.systemd1"
+	systemdPath    = "/org/freedesktop/systemd1"
+	systemdManager = "org.freedesktop.systemd1.Manager"
+	dbusProperties = "org.freedesktop.DBus.Properties"
+)
+
+type systemdConfig struct {
+	Enabled bool     `json:"enabled"`
+	Watch   []string `json:"watch"`
+}
+
+type systemdInfo struct {
+	FailedUnits []string          `json:"failed_units"`
+	Units       []systemdUnitInfo `json:"units,omitempty"`
+}
+
+type systemdUnitInfo struct {
+	Name           string `json:"name"`
+	LoadState      string `json:"load_state,omitempty"`
+	ActiveState    string `json:"active_state,omitempty"`
+	SubState       string `json:"sub_state,omitempty"`
+	Result         string `json:"result,omitempty"`
+	Restarts       uint64 `json:"restarts,omitempty"`
+	StateChangedAt string `json:"state_changed_at,omitempty"`
+	LastTriggerAt  string `json:"last_trigger_at,omitempty"`
+	NextTriggerAt  string `json:"next_trigger_at,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// readSystemd lists failed units and the state of watched units through the
+// systemd D-Bus API. Hosts not booted with systemd report nothing.
+func readSystemd() (*systemdInfo, error) {
+	if !cfg.Systemd.Enabled {
+		return nil, nil
+	}
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return nil, nil
+	}
+
+	conn, err := dialSystemBus(5 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	reply, err := conn.call(systemdDest, systemdPath, systemdManager, "ListUnits")
+	if err != nil {
+		return nil, err
+	}
+	info := &systemdInfo{FailedUnits: []string{}}
+	if len(reply) > 0 {
+		units, _ := reply[0].([]interface{})
+		for _, unit := range units {
+			fields, _ := unit.([]interface{})
+			if len(fields) < 4 {
+				continue
+			}
+			name, _ := fields[0].(string)
+			activeState, _ := fields[3].(string)
+			if activeState == "failed" {
+				info.FailedUnits = append(info.FailedUnits, name)
+			}
+		}
+	}
+	sort.Strings(info.FailedUnits)
+
+	for _, name := range cfg.Systemd.Watch {
+		info.Units = append(info.Units, readSystemdUnit(conn, name))
+	}
+	return info, nil
+}
+
+func readSystemdUnit(conn *dbusConn, name string) systemdUnitInfo {
+	unit := systemdUnitInfo{Name: name}
+
+	reply, err := conn.call(systemdDest, systemdPath, systemdManager, "LoadUnit", name)
+	if err != nil {
+		unit.Error = err.Error()
+		return unit
+	}
+	if len(reply) == 0 {
+		unit.Error = fmt.Sprintf("empty LoadUnit reply for %s", name)
+		return unit
+	}
+	path, ok := reply[0].(string)
+	if !ok {
+		unit.Error = fmt.Sprintf("unexpected LoadUnit reply for %s", name)
+		return unit
+	}
+
+	props, err := systemdProperties(conn, path, "org.freedesktop.systemd1.Unit")
+	if err != nil {
+		unit.Error = err.Error()
+		return unit
+	}
+	unit.LoadState = dbusString(props, "LoadState")
+	unit.ActiveState = dbusString(props, "ActiveState")
+	unit.SubState = dbusString(props, "SubState")
+	unit.StateChangedAt = formatUsecTimestamp(dbusUint(props, "StateChangeTimestamp"))
+
+	switch {
+	case strings.HasSuffix(name, ".service"):
+		if props, err := systemdProperties(conn, path, "org.freedesktop.systemd1.Service"); err == nil {
+			unit.Result = dbusString(props, "Result")
+			unit.Restarts = dbusUint(props, "NRestarts")
+		}
+	case strings.HasSuffix(name, ".timer"):
+		if props, err := systemdProperties(conn, path, "org.freedesktop.systemd1.Timer"); err == nil {
+			unit.Result = dbusString(props, "Result")
+			unit.LastTriggerAt = formatUsecTimestamp(dbusUint(props, "LastTriggerUSec"))
+			unit.NextTriggerAt = formatUsecTimestamp(dbusUint(props, "NextElapseUSecRealtime"))
+		}
+	}
+	return unit
+}
+
+func systemdProperties(conn *dbusConn, path, iface string) (map[string]interface{}, error) {
+	reply, err := conn.call(systemdDest, path, dbusProperties, "GetAll", iface)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) == 0 {
+		return nil, fmt.Errorf("empty GetAll reply for %s", path)
+	}
+	props, ok := reply[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected GetAll reply for %s", path)
+	}
+	return props, nil
+}
+
+func dbusString(props map[string]interface{}, key string) string {
+	s, _ := props[key].(string)
+	return s
+}
+
+func dbusUint(props map[string]interface{}, key string) uint64 {
+	switch v := props[key].(type) {
+	case uint64:
+		return v
+	case uint32:
+		return uint64(v)
+	}
+	return 0
+}
+
+// formatUsecTimestamp formats a systemd realtime timestamp in microseconds.
+// Zero and UINT64_MAX mean "never".
+func formatUsecTimestamp(usec uint64) string {
+	if usec == 0 || usec == math.MaxUint64 {
+		return ""
+	}
+	return time.UnixMicro(int64(usec)).UTC().Format(time.RFC3339)
+}
+
+func evaluateSystemdHealth(health *healthInfo, info *systemdInfo) {
+	if info == nil {
+		return
+	}
+	for _, unit := range info.Units {
+		switch {
+		case unit.ActiveState == "failed":
+			health.degrade("critical", fmt.Sprintf("unit '%s' failed", unit.Name))
+		case unit.LoadState == "not-found":
+			health.degrade("warning", fmt.Sprintf("unit '%s' not found", unit.Name))
+		}
+	}
+}
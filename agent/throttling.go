@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// throttledPatterns locate the firmware get_throttled attribute; the SoC
+// node name differs between Pi generations.
+var throttledPatterns = []string{
+	"/sys/devices/platform/soc/soc:firmware/get_throttled",
+	"/sys/devices/platform/soc*/soc*:firmware/get_throttled",
+}
+
+// Bits of the get_throttled mask. The same flags shifted by 16 are sticky
+// "has occurred since boot" bits.
+const (
+	throttleUnderVoltage    = 1 << 0
+	throttleFrequencyCapped = 1 << 1
+	throttleThrottled       = 1 << 2
+	throttleSoftTempLimit   = 1 << 3
+	throttleSinceBootShift  = 16
+)
+
+// socThrottleTemp is where the Pi firmware starts soft throttling.
+const socThrottleTemp = 80
+
+type throttlingConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+type throttlingInfo struct {
+	Raw       string        `json:"raw"`
+	Source    string        `json:"source"`
+	Current   throttleFlags `json:"current"`
+	SinceBoot throttleFlags `json:"since_boot"`
+	SoCTempC  float64       `json:"soc_temp_c,omitempty"`
+}
+
+type throttleFlags struct {
+	UnderVoltage    bool `json:"under_voltage"`
+	FrequencyCapped bool `json:"frequency_capped"`
+	Throttled       bool `json:"throttled"`
+	SoftTempLimit   bool `json:"soft_temp_limit"`
+}
+
+func newThrottleFlags(mask uint64) throttleFlags {
+	return throttleFlags{
+		UnderVoltage:    mask&throttleUnderVoltage != 0,
+		FrequencyCapped: mask&throttleFrequencyCapped != 0,
+		Throttled:       mask&throttleThrottled != 0,
+		SoftTempLimit:   mask&throttleSoftTempLimit != 0,
+	}
+}
+
+// readThrottling reads the Raspberry Pi firmware throttling mask from sysfs,
+// falling back to `vcgencmd get_throttled`. Other hosts report nothing.
+func readThrottling() (*throttlingInfo, error) {
+	if !cfg.Throttling.Enabled {
+		return nil, nil
+	}
+
+	raw, source := "", ""
+	for _, pattern := range throttledPatterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			if value := readSysfsString(path); value != "" {
+				raw, source = value, "sysfs"
+				break
+			}
+		}
+		if raw != "" {
+			break
+		}
+	}
+	if raw == "" {
+		value, err := readVcgencmdThrottled()
+		if err != nil {
+			return nil, nil
+		}
+		raw, source = value, "vcgencmd"
+	}
+
+	mask, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(raw), "0x"), 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse get_throttled %q: %w", raw, err)
+	}
+	return &throttlingInfo{
+		Raw:       fmt.Sprintf("0x%x", mask),
+		Source:    source,
+		Current:   newThrottleFlags(mask),
+		SinceBoot: newThrottleFlags(mask >> throttleSinceBootShift),
+		SoCTempC:  readSoCTemperature(),
+	}, nil
+}
+
+func readVcgencmdThrottled() (string, error) {
+	path, err := exec.LookPath("vcgencmd")
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "get_throttled").Output()
+	if err != nil {
+		return "", err
+	}
+	// Output looks like "throttled=0x50005".
+	_, value, ok := strings.Cut(strings.TrimSpace(string(out)), "=")
+	if !ok {
+		return "", fmt.Errorf("unexpected vcgencmd output %q", out)
+	}
+	return value, nil
+}
+
+// readSoCTemperature returns the cpu-thermal zone temperature, which on a
+// Pi is the SoC sensor the firmware throttles on.
+func readSoCTemperature() float64 {
+	zones, _ := filepath.Glob(filepath.Join(thermalRoot, "thermal_zone*"))
+	for _, zone := range zones {
+		if readSysfsString(filepath.Join(zone, "type")) != "cpu-thermal" {
+			continue
+		}
+		if temp, ok := readSysfsFloat(filepath.Join(zone, "temp")); ok {
+			return temp / 1000
+		}
+	}
+	return 0
+}
+
+func evaluateThrottlingHealth(health *healthInfo, info *throttlingInfo) {
+	if info == nil {
+		return
+	}
+	switch {
+	case info.Current.UnderVoltage:
+		health.degrade("critical", "under-voltage detected, check the power supply")
+	case info.SinceBoot.UnderVoltage:
+		health.degrade("warning", "under-voltage occurred since boot")
+	}
+	if info.Current.Throttled {
+		health.degrade("warning", "CPU throttled by firmware")
+	} else if info.Current.FrequencyCapped {
+		health.degrade("warning", "CPU frequency capped by firmware")
+	}
+	if info.Current.SoftTempLimit {
+		health.degrade("warning", "soft temperature limit active")
+	}
+	if info.SoCTempC >= socThrottleTemp {
+		health.degrade("warning", fmt.Sprintf("SoC temperature %.1f°C, throttling starts at %d°C", info.SoCTempC, socThrottleTemp))
+	}
+}
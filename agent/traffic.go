@@ -0,0 +1,408 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const trafficStateFile = "traffic.json"
+
+// How many buckets of each size are kept.
+const (
+	trafficHourlyBuckets  = 48
+	trafficDailyBuckets   = 62
+	trafficMonthlyBuckets = 24
+)
+
+type trafficConfig struct {
+	Enabled        bool     `json:"enabled"`
+	SampleInterval duration `json:"sample_interval"`
+	// BillingDay is the day of the month (1-28) a billing cycle starts.
+	BillingDay int `json:"billing_day"`
+	// Interfaces are globs of accounted interfaces; empty means the same
+	// uplinks that make up net_rx_bps/net_tx_bps.
+	Interfaces []string       `json:"interfaces"`
+	Quotas     []trafficQuota `json:"quotas"`
+}
+
+// trafficQuota is a plan allowance per billing cycle. LimitGB is in
+// decimal gigabytes, as providers bill.
+type trafficQuota struct {
+	Name        string   `json:"name"`
+	Interfaces  []string `json:"interfaces"`
+	Direction   string   `json:"direction"`
+	LimitGB     float64  `json:"limit_gb"`
+	WarnPercent float64  `json:"warn_percent"`
+}
+
+type trafficBucket struct {
+	Start   string `json:"start"`
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+}
+
+type trafficInterface struct {
+	LastRx uint64 `json:"last_rx"`
+	LastTx uint64 `json:"last_tx"`
+	// LastAt is when LastRx and LastTx were read, in Unix seconds.
+	LastAt  int64           `json:"last_at,omitempty"`
+	Hourly  []trafficBucket `json:"hourly"`
+	Daily   []trafficBucket `json:"daily"`
+	Monthly []trafficBucket `json:"monthly"`
+}
+
+type trafficState struct {
+	BootID     string                       `json:"boot_id"`
+	Interfaces map[string]*trafficInterface `json:"interfaces"`
+}
+
+type trafficInfo struct {
+	CycleStart string                 `json:"cycle_start"`
+	Interfaces []trafficInterfaceInfo `json:"interfaces"`
+	Quotas     []trafficQuotaInfo     `json:"quotas,omitempty"`
+}
+
+type trafficInterfaceInfo struct {
+	Name         string `json:"name"`
+	CycleRxBytes uint64 `json:"cycle_rx_bytes"`
+	CycleTxBytes uint64 `json:"cycle_tx_bytes"`
+	TodayRxBytes uint64 `json:"today_rx_bytes"`
+	TodayTxBytes uint64 `json:"today_tx_bytes"`
+}
+
+type trafficQuotaInfo struct {
+	Name        string  `json:"name"`
+	Direction   string  `json:"direction"`
+	UsedBytes   uint64  `json:"used_bytes"`
+	LimitBytes  uint64  `json:"limit_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+	Status      string  `json:"status"`
+}
+
+// trafficReport is the /traffic response with the full bucket history.
+type trafficReport struct {
+	CycleStart string                   `json:"cycle_start"`
+	Interfaces []trafficInterfaceReport `json:"interfaces"`
+	Quotas     []trafficQuotaInfo       `json:"quotas,omitempty"`
+}
+
+type trafficInterfaceReport struct {
+	Name    string          `json:"name"`
+	Hourly  []trafficBucket `json:"hourly"`
+	Daily   []trafficBucket `json:"daily"`
+	Monthly []trafficBucket `json:"monthly"`
+}
+
+type trafficAccounting struct {
+	mu    sync.Mutex
+	state trafficState
+}
+
+var traffic = &trafficAccounting{state: trafficState{Interfaces: map[string]*trafficInterface{}}}
+
+func (q trafficQuota) validate() error {
+	if q.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if q.LimitGB <= 0 {
+		return fmt.Errorf("%s: limit_gb must be positive", q.Name)
+	}
+	switch q.Direction {
+	case "", "total", "rx", "tx":
+	default:
+		return fmt.Errorf("%s: direction must be total, rx or tx", q.Name)
+	}
+	return nil
+}
+
+func (c trafficConfig) validate() error {
+	if c.BillingDay < 1 || c.BillingDay > 28 {
+		return fmt.Errorf("billing_day must be between 1 and 28")
+	}
+	if c.Enabled && c.SampleInterval.Duration <= 0 {
+		return fmt.Errorf("sample_interval must be positive")
+	}
+	for i, quota := range c.Quotas {
+		if err := quota.validate(); err != nil {
+			return fmt.Errorf("quotas[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// runTrafficAccounting adds the counter growth of accounted interfaces to
+// hourly, daily and billing-cycle buckets every sample_interval. Counters
+// are persisted, so traffic while the agent was down is still counted,
+// and a reboot or counter reset starts again from the new counter value.
+func runTrafficAccounting() {
+	if !cfg.Traffic.Enabled {
+		return
+	}
+	state := trafficState{}
+	if err := readState(trafficStateFile, &state); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("load traffic state failed: %v", err)
+	}
+	traffic.mu.Lock()
+	if state.Interfaces != nil {
+		traffic.state = state
+	}
+	traffic.mu.Unlock()
+
+	ticker := time.NewTicker(cfg.Traffic.SampleInterval.Duration)
+	defer ticker.Stop()
+	for {
+		if err := traffic.sample(time.Now()); err != nil {
+			log.Printf("traffic accounting failed: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+func (a *trafficAccounting) sample(now time.Time) error {
+	stats, err := readNetSnapshotFile("/proc/net/dev")
+	if err != nil {
+		return err
+	}
+	bootID := readSysfsString("/proc/sys/kernel/random/boot_id")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.add(now, stats, bootID)
+	return writeState(trafficStateFile, a.state)
+}
+
+// add accounts one reading of the interface counters. Interfaces that are
+// present but no longer accounted, e.g. after the interfaces globs changed,
+// are dropped so their history stops counting towards quotas; interfaces
+// that disappeared keep theirs until they come back.
+func (a *trafficAccounting) add(now time.Time, stats map[string]netSnapshot, bootID string) {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	accounted := trafficInterfaces(names)
+	rebooted := a.state.BootID != "" && a.state.BootID != bootID
+	a.state.BootID = bootID
+
+	hour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location()).Format(time.RFC3339)
+	day := startOfDay(now).Format(time.RFC3339)
+	cycle := billingCycleStart(now, cfg.Traffic.BillingDay).Format(time.RFC3339)
+	for name, counters := range stats {
+		if !accounted[name] {
+			delete(a.state.Interfaces, name)
+			continue
+		}
+		iface := a.state.Interfaces[name]
+		if iface == nil {
+			// The first sighting only sets the baseline.
+			a.state.Interfaces[name] = &trafficInterface{LastRx: counters.RxBytes, LastTx: counters.TxBytes, LastAt: now.Unix()}
+			continue
+		}
+		// The wrap bound scales with the real gap, which is longer than
+		// sample_interval after the agent was stopped. State written before
+		// LastAt existed falls back to the interval.
+		seconds := cfg.Traffic.SampleInterval.Duration.Seconds()
+		if iface.LastAt > 0 {
+			seconds = now.Sub(time.Unix(iface.LastAt, 0)).Seconds()
+		}
+		rx := trafficDelta(iface.LastRx, counters.RxBytes, seconds, rebooted)
+		tx := trafficDelta(iface.LastTx, counters.TxBytes, seconds, rebooted)
+		iface.LastRx, iface.LastTx, iface.LastAt = counters.RxBytes, counters.TxBytes, now.Unix()
+		iface.Hourly = addTraffic(iface.Hourly, hour, rx, tx, trafficHourlyBuckets)
+		iface.Daily = addTraffic(iface.Daily, day, rx, tx, trafficDailyBuckets)
+		iface.Monthly = addTraffic(iface.Monthly, cycle, rx, tx, trafficMonthlyBuckets)
+	}
+}
+
+func trafficInterfaces(names []string) map[string]bool {
+	if len(cfg.Traffic.Interfaces) == 0 {
+		return uplinkInterfaces(names)
+	}
+	accounted := map[string]bool{}
+	for _, name := range names {
+		if matchAnyGlob(cfg.Traffic.Interfaces, name) {
+			accounted[name] = true
+		}
+	}
+	return accounted
+}
+
+// trafficDelta is the growth of a byte counter over seconds. After a
+// reboot, or when the counter was reset because the interface was
+// recreated, everything counted since the reset is new traffic.
+func trafficDelta(last, current uint64, seconds float64, rebooted bool) uint64 {
+	if rebooted {
+		return current
+	}
+	if delta, ok := counter32Delta(last, current, seconds); ok {
+		return delta
+	}
+	return current
+}
+
+func addTraffic(buckets []trafficBucket, start string, rx, tx uint64, keep int) []trafficBucket {
+	if n := len(buckets); n > 0 && buckets[n-1].Start == start {
+		buckets[n-1].RxBytes += rx
+		buckets[n-1].TxBytes += tx
+		return buckets
+	}
+	buckets = append(buckets, trafficBucket{Start: start, RxBytes: rx, TxBytes: tx})
+	if len(buckets) > keep {
+		buckets = append([]trafficBucket(nil), buckets[len(buckets)-keep:]...)
+	}
+	return buckets
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// billingCycleStart returns midnight of the most recent billing day.
+func billingCycleStart(t time.Time, billingDay int) time.Time {
+	start := time.Date(t.Year(), t.Month(), billingDay, 0, 0, 0, 0, t.Location())
+	if t.Day() < billingDay {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+func bucketAt(buckets []trafficBucket, start string) trafficBucket {
+	if n := len(buckets); n > 0 && buckets[n-1].Start == start {
+		return buckets[n-1]
+	}
+	return trafficBucket{Start: start}
+}
+
+func readTraffic(now time.Time) *trafficInfo {
+	if !cfg.Traffic.Enabled {
+		return nil
+	}
+	cycle := billingCycleStart(now, cfg.Traffic.BillingDay).Format(time.RFC3339)
+	day := startOfDay(now).Format(time.RFC3339)
+
+	traffic.mu.Lock()
+	defer traffic.mu.Unlock()
+	if len(traffic.state.Interfaces) == 0 {
+		return nil
+	}
+	info := &trafficInfo{CycleStart: cycle, Interfaces: []trafficInterfaceInfo{}}
+	for _, name := range traffic.sortedNames() {
+		iface := traffic.state.Interfaces[name]
+		month, today := bucketAt(iface.Monthly, cycle), bucketAt(iface.Daily, day)
+		info.Interfaces = append(info.Interfaces, trafficInterfaceInfo{
+			Name:         name,
+			CycleRxBytes: month.RxBytes,
+			CycleTxBytes: month.TxBytes,
+			TodayRxBytes: today.RxBytes,
+			TodayTxBytes: today.TxBytes,
+		})
+	}
+	info.Quotas = traffic.quotas(cycle)
+	return info
+}
+
+func (a *trafficAccounting) sortedNames() []string {
+	names := make([]string, 0, len(a.state.Interfaces))
+	for name := range a.state.Interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *trafficAccounting) quotas(cycle string) []trafficQuotaInfo {
+	var result []trafficQuotaInfo
+	for _, quota := range cfg.Traffic.Quotas {
+		info := trafficQuotaInfo{
+			Name:       quota.Name,
+			Direction:  quota.Direction,
+			LimitBytes: uint64(quota.LimitGB * 1e9),
+			Status:     "ok",
+		}
+		if info.Direction == "" {
+			info.Direction = "total"
+		}
+		for name, iface := range a.state.Interfaces {
+			if len(quota.Interfaces) > 0 && !matchAnyGlob(quota.Interfaces, name) {
+				continue
+			}
+			month := bucketAt(iface.Monthly, cycle)
+			switch info.Direction {
+			case "rx":
+				info.UsedBytes += month.RxBytes
+			case "tx":
+				info.UsedBytes += month.TxBytes
+			default:
+				info.UsedBytes += month.RxBytes + month.TxBytes
+			}
+		}
+		info.UsedPercent = percent(float64(info.UsedBytes), float64(info.LimitBytes))
+		warnAt := quota.WarnPercent
+		if warnAt <= 0 {
+			warnAt = 80
+		}
+		switch {
+		case info.UsedBytes >= info.LimitBytes:
+			info.Status = "critical"
+		case info.UsedPercent >= warnAt:
+			info.Status = "warning"
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+func handleTraffic(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !cfg.Traffic.Enabled {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("traffic accounting disabled"))
+			return
+		}
+
+		cycle := billingCycleStart(time.Now(), cfg.Traffic.BillingDay).Format(time.RFC3339)
+		traffic.mu.Lock()
+		report := trafficReport{CycleStart: cycle, Interfaces: []trafficInterfaceReport{}}
+		for _, name := range traffic.sortedNames() {
+			iface := traffic.state.Interfaces[name]
+			report.Interfaces = append(report.Interfaces, trafficInterfaceReport{
+				Name:    name,
+				Hourly:  append([]trafficBucket{}, iface.Hourly...),
+				Daily:   append([]trafficBucket{}, iface.Daily...),
+				Monthly: append([]trafficBucket{}, iface.Monthly...),
+			})
+		}
+		report.Quotas = traffic.quotas(cycle)
+		traffic.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+func evaluateTrafficHealth(health *healthInfo, info *trafficInfo) {
+	if info == nil {
+		return
+	}
+	for _, q := range info.Quotas {
+		if q.Status == "ok" {
+			continue
+		}
+		health.degrade(q.Status, fmt.Sprintf("traffic quota '%s' at %.0f%% (%s)", q.Name, q.UsedPercent, q.Direction))
+	}
+}
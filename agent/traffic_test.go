@@ -0,0 +1,193 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBillingCycleStart(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name       string
+		now        time.Time
+		billingDay int
+		want       time.Time
+	}{
+		{"first of the month", utc(2024, 6, 1, 0), 1, utc(2024, 6, 1, 0)},
+		{"mid month", utc(2024, 6, 17, 13), 1, utc(2024, 6, 1, 0)},
+		{"on the billing day", utc(2024, 6, 15, 8), 15, utc(2024, 6, 15, 0)},
+		{"before the billing day", utc(2024, 6, 14, 23), 15, utc(2024, 5, 15, 0)},
+		{"day 28 in February", utc(2023, 2, 28, 12), 28, utc(2023, 2, 28, 0)},
+		{"end of February", utc(2024, 2, 29, 12), 28, utc(2024, 2, 28, 0)},
+		{"early February", utc(2024, 2, 10, 12), 28, utc(2024, 1, 28, 0)},
+		{"day 28 in January", utc(2024, 1, 27, 12), 28, utc(2023, 12, 28, 0)},
+		{"end of January", utc(2024, 1, 31, 12), 28, utc(2024, 1, 28, 0)},
+		{"early March", utc(2024, 3, 1, 0), 28, utc(2024, 2, 28, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := billingCycleStart(tt.now, tt.billingDay); !got.Equal(tt.want) {
+				t.Errorf("billingCycleStart = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddTraffic(t *testing.T) {
+	var buckets []trafficBucket
+	buckets = addTraffic(buckets, "h1", 10, 1, 3)
+	buckets = addTraffic(buckets, "h1", 5, 2, 3)
+	want := []trafficBucket{{Start: "h1", RxBytes: 15, TxBytes: 3}}
+	if !reflect.DeepEqual(buckets, want) {
+		t.Fatalf("same bucket = %+v, want %+v", buckets, want)
+	}
+
+	// A new period rolls over to a new bucket and the oldest are trimmed.
+	for _, start := range []string{"h2", "h3", "h4"} {
+		buckets = addTraffic(buckets, start, 1, 1, 3)
+	}
+	var starts []string
+	for _, b := range buckets {
+		starts = append(starts, b.Start)
+	}
+	if !reflect.DeepEqual(starts, []string{"h2", "h3", "h4"}) {
+		t.Errorf("kept buckets %v, want [h2 h3 h4]", starts)
+	}
+
+	if got := bucketAt(buckets, "h4"); got != (trafficBucket{Start: "h4", RxBytes: 1, TxBytes: 1}) {
+		t.Errorf("bucketAt(h4) = %+v", got)
+	}
+	// Only the latest bucket counts as current; an older period is empty.
+	if got := bucketAt(buckets, "h3"); got != (trafficBucket{Start: "h3"}) {
+		t.Errorf("bucketAt(h3) = %+v", got)
+	}
+	if got := bucketAt(nil, "h1"); got != (trafficBucket{Start: "h1"}) {
+		t.Errorf("bucketAt on no buckets = %+v", got)
+	}
+}
+
+func TestTrafficQuotas(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+
+	const cycle = "2024-06-01T00:00:00Z"
+	a := &trafficAccounting{state: trafficState{Interfaces: map[string]*trafficInterface{
+		"eth0": {Monthly: []trafficBucket{{Start: cycle, RxBytes: 6e9, TxBytes: 2e9}}},
+		"eth1": {Monthly: []trafficBucket{{Start: cycle, RxBytes: 2e9, TxBytes: 0}}},
+		// Last cycle's traffic does not count.
+		"wwan0": {Monthly: []trafficBucket{{Start: "2024-05-01T00:00:00Z", RxBytes: 50e9, TxBytes: 50e9}}},
+	}}}
+
+	tests := []struct {
+		quota  trafficQuota
+		used   uint64
+		status string
+	}{
+		{trafficQuota{Name: "rx", Direction: "rx", LimitGB: 10}, 8e9, "warning"},
+		{trafficQuota{Name: "tx", Direction: "tx", LimitGB: 10}, 2e9, "ok"},
+		{trafficQuota{Name: "total", LimitGB: 10}, 10e9, "critical"},
+		{trafficQuota{Name: "eth0 total", Direction: "total", Interfaces: []string{"eth0"}, LimitGB: 10}, 8e9, "warning"},
+		{trafficQuota{Name: "below warn", Direction: "rx", LimitGB: 10, WarnPercent: 90}, 8e9, "ok"},
+		{trafficQuota{Name: "just below 80%", Direction: "rx", LimitGB: 10.000000001}, 8e9, "ok"},
+		{trafficQuota{Name: "eth1 rx", Direction: "rx", Interfaces: []string{"eth1"}, LimitGB: 2.5}, 2e9, "warning"},
+		{trafficQuota{Name: "eth1 over", Direction: "rx", Interfaces: []string{"eth1"}, LimitGB: 1}, 2e9, "critical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.quota.Name, func(t *testing.T) {
+			cfg.Traffic.Quotas = []trafficQuota{tt.quota}
+			got := a.quotas(cycle)
+			if len(got) != 1 {
+				t.Fatalf("got %d quotas", len(got))
+			}
+			if got[0].UsedBytes != tt.used || got[0].Status != tt.status {
+				t.Errorf("quota = %+v, want used %d status %s", got[0], tt.used, tt.status)
+			}
+		})
+	}
+
+	cfg.Traffic.Quotas = []trafficQuota{{Name: "total", LimitGB: 10}}
+	info := &trafficInfo{Quotas: a.quotas(cycle)}
+	health := healthInfo{Status: "ok"}
+	evaluateTrafficHealth(&health, info)
+	if health.Status != "critical" || !reflect.DeepEqual(health.Reasons, []string{"traffic quota 'total' at 100% (total)"}) {
+		t.Errorf("health = %+v", health)
+	}
+}
+
+func TestTrafficAdd(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+	cfg.Traffic.Interfaces = []string{"eth*"}
+
+	a := &trafficAccounting{state: trafficState{Interfaces: map[string]*trafficInterface{}}}
+	now := time.Date(2024, 6, 17, 10, 5, 0, 0, time.Local)
+
+	// The first sighting of an interface only sets the baseline.
+	a.add(now, map[string]netSnapshot{
+		"eth0": {RxBytes: 1000, TxBytes: 500},
+		"lo":   {RxBytes: 9000, TxBytes: 9000},
+	}, "boot-1")
+	if iface := a.state.Interfaces["eth0"]; iface == nil || iface.LastRx != 1000 || len(iface.Hourly) != 0 {
+		t.Fatalf("baseline = %+v", iface)
+	}
+	if _, ok := a.state.Interfaces["lo"]; ok {
+		t.Fatal("unaccounted interface was recorded")
+	}
+
+	now = now.Add(5 * time.Minute)
+	a.add(now, map[string]netSnapshot{"eth0": {RxBytes: 1600, TxBytes: 700}}, "boot-1")
+	month := bucketAt(a.state.Interfaces["eth0"].Monthly, billingCycleStart(now, 1).Format(time.RFC3339))
+	if month.RxBytes != 600 || month.TxBytes != 200 {
+		t.Errorf("cycle bucket = %+v, want 600/200", month)
+	}
+
+	// After a reboot the counters start over and count in full.
+	now = now.Add(5 * time.Minute)
+	a.add(now, map[string]netSnapshot{"eth0": {RxBytes: 100, TxBytes: 50}}, "boot-2")
+	today := bucketAt(a.state.Interfaces["eth0"].Daily, startOfDay(now).Format(time.RFC3339))
+	if today.RxBytes != 700 || today.TxBytes != 250 {
+		t.Errorf("day bucket = %+v, want 700/250", today)
+	}
+
+	// Narrowing the globs drops eth0; a vanished interface keeps its history.
+	a.state.Interfaces["eth9"] = &trafficInterface{LastRx: 1}
+	cfg.Traffic.Interfaces = []string{"wan*"}
+	a.add(now.Add(5*time.Minute), map[string]netSnapshot{"eth0": {RxBytes: 200, TxBytes: 60}}, "boot-2")
+	if _, ok := a.state.Interfaces["eth0"]; ok {
+		t.Error("no longer accounted interface was kept")
+	}
+	if _, ok := a.state.Interfaces["eth9"]; !ok {
+		t.Error("vanished interface was dropped")
+	}
+}
+
+// The wrap bound follows the time since the interface was last read, not
+// sample_interval, so a gap in sampling does not turn a wrap into a reset.
+func TestTrafficAddWrapUsesElapsedTime(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+	cfg.Traffic.Interfaces = []string{"eth0"}
+	cfg.Traffic.SampleInterval = duration{time.Second}
+
+	now := time.Date(2024, 6, 17, 10, 0, 0, 0, time.Local)
+	a := &trafficAccounting{state: trafficState{Interfaces: map[string]*trafficInterface{}}}
+	a.add(now, map[string]netSnapshot{"eth0": {RxBytes: math.MaxUint32 - 999, TxBytes: 0}}, "boot")
+
+	// 4e9 bytes in ten seconds is a plausible wrap, in one second it is not.
+	now = now.Add(10 * time.Second)
+	a.add(now, map[string]netSnapshot{"eth0": {RxBytes: 4e9 - 1000, TxBytes: 0}}, "boot")
+	iface := a.state.Interfaces["eth0"]
+	if got := bucketAt(iface.Daily, startOfDay(now).Format(time.RFC3339)).RxBytes; got != 4e9 {
+		t.Errorf("rx across the wrap = %d, want 4e9", got)
+	}
+	if iface.LastAt != now.Unix() {
+		t.Errorf("last_at = %d, want %d", iface.LastAt, now.Unix())
+	}
+}
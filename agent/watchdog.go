@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processWatch describes a program that must be running. Every criterion
+// that is set has to match. Min defaults to 1; Max of 0 means no limit.
+type processWatch struct {
+	Name    string `json:"name"`
+	Process string `json:"process"`
+	Cmdline string `json:"cmdline"`
+	Pidfile string `json:"pidfile"`
+	User    string `json:"user"`
+	Min     *int   `json:"min"`
+	Max     int    `json:"max"`
+}
+
+type watchedProcessInfo struct {
+	Name          string  `json:"name"`
+	Status        string  `json:"status"`
+	Count         int     `json:"count"`
+	Min           int     `json:"min"`
+	Max           int     `json:"max,omitempty"`
+	PIDs          []int   `json:"pids"`
+	UptimeSeconds int64   `json:"uptime_seconds,omitempty"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	RSSMB         float64 `json:"rss_mb"`
+}
+
+func (w processWatch) validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if w.Process == "" && w.Cmdline == "" && w.Pidfile == "" && w.User == "" {
+		return fmt.Errorf("%s: one of process, cmdline, pidfile or user is required", w.Name)
+	}
+	if _, err := regexp.Compile(w.Cmdline); err != nil {
+		return fmt.Errorf("%s: %w", w.Name, err)
+	}
+	if w.minCount() < 0 || (w.Max > 0 && w.Max < w.minCount()) {
+		return fmt.Errorf("%s: invalid min/max", w.Name)
+	}
+	return nil
+}
+
+func (w processWatch) minCount() int {
+	if w.Min == nil {
+		return 1
+	}
+	return *w.Min
+}
+
+// processDetails lazily reads per-process files that only some watches need.
+type processDetails struct {
+	cmdlines map[int][]string
+	uids     map[int]string
+}
+
+func (d *processDetails) cmdline(pid int) []string {
+	if args, ok := d.cmdlines[pid]; ok {
+		return args
+	}
+	var args []string
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err == nil && len(data) > 0 {
+		args = strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	}
+	d.cmdlines[pid] = args
+	return args
+}
+
+func (d *processDetails) user(pid int) (string, string) {
+	uid, ok := d.uids[pid]
+	if !ok {
+		uid = readProcUID(strconv.Itoa(pid))
+		d.uids[pid] = uid
+	}
+	return uid, lookupUserName(uid)
+}
+
+// watchProcesses evaluates the configured watches against a scan.
+// measured[i] must describe procs[i].
+func watchProcesses(procs []procStat, measured []processInfo, now time.Time) []watchedProcessInfo {
+	if len(cfg.Processes.Watch) == 0 {
+		return nil
+	}
+	boot, bootErr := time.Parse(time.RFC3339, readBootTime())
+	details := &processDetails{cmdlines: map[int][]string{}, uids: map[int]string{}}
+
+	result := make([]watchedProcessInfo, 0, len(cfg.Processes.Watch))
+	for _, watch := range cfg.Processes.Watch {
+		info := watchedProcessInfo{
+			Name: watch.Name,
+			Min:  watch.minCount(),
+			Max:  watch.Max,
+			PIDs: []int{},
+		}
+
+		var cmdline *regexp.Regexp
+		if watch.Cmdline != "" {
+			cmdline = regexp.MustCompile(watch.Cmdline)
+		}
+		pidfilePID := -1
+		if watch.Pidfile != "" {
+			pidfilePID = readPidfile(watch.Pidfile)
+		}
+
+		var oldest time.Time
+		for i, proc := range procs {
+			if watch.Pidfile != "" && proc.PID != pidfilePID {
+				continue
+			}
+			if watch.Process != "" && !matchProcessName(proc, watch.Process, details) {
+				continue
+			}
+			if cmdline != nil && !cmdline.MatchString(strings.Join(details.cmdline(proc.PID), " ")) {
+				continue
+			}
+			if watch.User != "" {
+				uid, name := details.user(proc.PID)
+				if watch.User != uid && watch.User != name {
+					continue
+				}
+			}
+
+			info.PIDs = append(info.PIDs, proc.PID)
+			info.CPUPercent += measured[i].CPUPercent
+			info.RSSMB += measured[i].RSSMB
+			if bootErr == nil {
+				started := proc.startTime(boot)
+				if oldest.IsZero() || started.Before(oldest) {
+					oldest = started
+				}
+			}
+		}
+
+		info.Count = len(info.PIDs)
+		if !oldest.IsZero() {
+			info.UptimeSeconds = int64(now.Sub(oldest).Seconds())
+		}
+		switch {
+		case info.Count == 0 && info.Min > 0:
+			info.Status = "missing"
+		case info.Count < info.Min:
+			info.Status = "too_few"
+		case info.Max > 0 && info.Count > info.Max:
+			info.Status = "too_many"
+		default:
+			info.Status = "ok"
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// matchProcessName compares against comm, falling back to the executable
+// name from the command line because the kernel truncates comm to 15 bytes.
+func matchProcessName(proc procStat, name string, details *processDetails) bool {
+	if proc.Comm == name {
+		return true
+	}
+	if len(proc.Comm) < 15 || !strings.HasPrefix(name, proc.Comm) {
+		return false
+	}
+	args := details.cmdline(proc.PID)
+	return len(args) > 0 && filepath.Base(args[0]) == name
+}
+
+func readPidfile(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return -1
+	}
+	return pid
+}
+
+func evaluateWatchdogHealth(health *healthInfo, watched []watchedProcessInfo) {
+	for _, w := range watched {
+		switch w.Status {
+		case "missing":
+			health.degrade("critical", fmt.Sprintf("process '%s' not running", w.Name))
+		case "too_few":
+			health.degrade("critical", fmt.Sprintf("process '%s' has %d instances, expected at least %d", w.Name, w.Count, w.Min))
+		case "too_many":
+			health.degrade("warning", fmt.Sprintf("process '%s' has %d instances, expected at most %d", w.Name, w.Count, w.Max))
+		}
+	}
+}
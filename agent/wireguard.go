@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+type wireguardConfig struct {
+	Enabled bool `json:"enabled"`
+	// HandshakeMaxAge is the default for peers without their own
+	// max_handshake_age. WireGuard re-handshakes every 2 minutes while
+	// traffic flows, so an active tunnel stays well below it.
+	HandshakeMaxAge duration              `json:"handshake_max_age"`
+	Peers           []wireguardPeerConfig `json:"peers"`
+}
+
+// wireguardPeerConfig names a peer and makes its handshake age part of
+// health.
+type wireguardPeerConfig struct {
+	Name            string   `json:"name"`
+	PublicKey       string   `json:"public_key"`
+	MaxHandshakeAge duration `json:"max_handshake_age"`
+}
+
+type wireguardInterfaceInfo struct {
+	Name       string              `json:"name"`
+	PublicKey  string              `json:"public_key,omitempty"`
+	ListenPort int                 `json:"listen_port,omitempty"`
+	Peers      []wireguardPeerInfo `json:"peers"`
+}
+
+type wireguardPeerInfo struct {
+	Name       string   `json:"name,omitempty"`
+	PublicKey  string   `json:"public_key"`
+	Endpoint   string   `json:"endpoint,omitempty"`
+	AllowedIPs []string `json:"allowed_ips"`
+	// LatestHandshake and HandshakeAgeSeconds are absent until the first
+	// handshake.
+	LatestHandshake     string `json:"latest_handshake,omitempty"`
+	HandshakeAgeSeconds *int64 `json:"handshake_age_seconds,omitempty"`
+	KeepaliveSeconds    int    `json:"persistent_keepalive,omitempty"`
+	RxBytes             uint64 `json:"rx_bytes"`
+	TxBytes             uint64 `json:"tx_bytes"`
+}
+
+func (c wireguardConfig) validate() error {
+	if c.Enabled && c.HandshakeMaxAge.Duration <= 0 {
+		return fmt.Errorf("handshake_max_age must be positive")
+	}
+	for i, peer := range c.Peers {
+		key, err := base64.StdEncoding.DecodeString(peer.PublicKey)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("peers[%d]: bad public_key", i)
+		}
+	}
+	return nil
+}
+
+// evaluateWireguardHealth checks the handshake age of watched peers. When
+// the interfaces could not be read, readErr is reported once rather than
+// every watched peer as missing.
+func evaluateWireguardHealth(health *healthInfo, interfaces []wireguardInterfaceInfo, readErr error) {
+	if !cfg.Wireguard.Enabled || len(cfg.Wireguard.Peers) == 0 {
+		return
+	}
+	if readErr != nil {
+		health.degrade("warning", fmt.Sprintf("wireguard peers unknown: %v", readErr))
+		return
+	}
+	for _, watched := range cfg.Wireguard.Peers {
+		name := watched.Name
+		if name == "" {
+			name = watched.PublicKey
+		}
+		maxAge := watched.MaxHandshakeAge.Duration
+		if maxAge <= 0 {
+			maxAge = cfg.Wireguard.HandshakeMaxAge.Duration
+		}
+
+		var peer *wireguardPeerInfo
+		for i := range interfaces {
+			for j := range interfaces[i].Peers {
+				if interfaces[i].Peers[j].PublicKey == watched.PublicKey {
+					peer = &interfaces[i].Peers[j]
+				}
+			}
+		}
+		switch {
+		case peer == nil:
+			health.degrade("warning", fmt.Sprintf("wireguard peer '%s' not found", name))
+		case peer.HandshakeAgeSeconds == nil:
+			health.degrade("critical", fmt.Sprintf("wireguard peer '%s' has never completed a handshake", name))
+		case time.Duration(*peer.HandshakeAgeSeconds)*time.Second > maxAge:
+			health.degrade("critical", fmt.Sprintf("wireguard peer '%s' last handshake %dm ago", name, *peer.HandshakeAgeSeconds/60))
+		}
+	}
+}
@@ -0,0 +1,200 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// WireGuard generic netlink API (include/uapi/linux/wireguard.h).
+const (
+	wgGenlName      = "wireguard"
+	wgGenlVersion   = 1
+	wgCmdGetDevice  = 0
+	wgDeviceIfname  = 2
+	wgDevicePubKey  = 4
+	wgDeviceListen  = 6
+	wgDevicePeers   = 8
+	wgPeerPubKey    = 1
+	wgPeerEndpoint  = 4
+	wgPeerKeepalive = 5
+	wgPeerHandshake = 6
+	wgPeerRxBytes   = 7
+	wgPeerTxBytes   = 8
+	wgPeerAllowedIP = 9
+	wgAllowedAddr   = 2
+	wgAllowedCIDR   = 3
+
+	wgNetlinkTimeout = 2 * time.Second
+)
+
+// readWireguard queries every kernel WireGuard interface over netlink,
+// which requires CAP_NET_ADMIN.
+func readWireguard(now time.Time) ([]wireguardInterfaceInfo, error) {
+	if !cfg.Wireguard.Enabled {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(netClassRoot)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if classifyInterface(entry.Name()) == "wireguard" {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	conn, err := dialGenetlink(wgNetlinkTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	family, err := conn.resolveFamily(wgGenlName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]wireguardInterfaceInfo, 0, len(names))
+	for _, name := range names {
+		replies, err := conn.execute(family, wgCmdGetDevice, wgGenlVersion, syscall.NLM_F_DUMP,
+			appendNetlinkAttr(nil, wgDeviceIfname, netlinkString(name)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		result = append(result, parseWireguardDevice(name, replies, now))
+	}
+	return result, nil
+}
+
+// parseWireguardDevice merges a device dump. Large devices span several
+// messages, and a peer whose allowed IPs do not fit is continued in the
+// next message under the same public key.
+func parseWireguardDevice(name string, replies [][]byte, now time.Time) wireguardInterfaceInfo {
+	iface := wireguardInterfaceInfo{Name: name, Peers: []wireguardPeerInfo{}}
+	byKey := map[string]int{}
+	for _, reply := range replies {
+		for _, attr := range parseNetlinkAttrs(reply) {
+			switch attr.Type {
+			case wgDevicePubKey:
+				iface.PublicKey = base64.StdEncoding.EncodeToString(attr.Value)
+			case wgDeviceListen:
+				if len(attr.Value) >= 2 {
+					iface.ListenPort = int(binary.NativeEndian.Uint16(attr.Value))
+				}
+			case wgDevicePeers:
+				for _, nested := range parseNetlinkAttrs(attr.Value) {
+					peer := parseWireguardPeer(nested.Value, now)
+					if i, ok := byKey[peer.PublicKey]; ok {
+						iface.Peers[i].AllowedIPs = append(iface.Peers[i].AllowedIPs, peer.AllowedIPs...)
+						continue
+					}
+					byKey[peer.PublicKey] = len(iface.Peers)
+					iface.Peers = append(iface.Peers, peer)
+				}
+			}
+		}
+	}
+	sort.Slice(iface.Peers, func(i, j int) bool {
+		return iface.Peers[i].PublicKey < iface.Peers[j].PublicKey
+	})
+	return iface
+}
+
+func parseWireguardPeer(b []byte, now time.Time) wireguardPeerInfo {
+	peer := wireguardPeerInfo{AllowedIPs: []string{}}
+	for _, attr := range parseNetlinkAttrs(b) {
+		switch attr.Type {
+		case wgPeerPubKey:
+			peer.PublicKey = base64.StdEncoding.EncodeToString(attr.Value)
+		case wgPeerEndpoint:
+			peer.Endpoint = parseSockaddr(attr.Value)
+		case wgPeerKeepalive:
+			if len(attr.Value) >= 2 {
+				peer.KeepaliveSeconds = int(binary.NativeEndian.Uint16(attr.Value))
+			}
+		case wgPeerHandshake:
+			// struct __kernel_timespec; zero means no handshake yet.
+			if len(attr.Value) >= 16 {
+				sec := int64(binary.NativeEndian.Uint64(attr.Value[0:8]))
+				nsec := int64(binary.NativeEndian.Uint64(attr.Value[8:16]))
+				if sec != 0 || nsec != 0 {
+					at := time.Unix(sec, nsec)
+					age := int64(now.Sub(at).Seconds())
+					peer.LatestHandshake = at.UTC().Format(time.RFC3339)
+					peer.HandshakeAgeSeconds = &age
+				}
+			}
+		case wgPeerRxBytes:
+			if len(attr.Value) >= 8 {
+				peer.RxBytes = binary.NativeEndian.Uint64(attr.Value)
+			}
+		case wgPeerTxBytes:
+			if len(attr.Value) >= 8 {
+				peer.TxBytes = binary.NativeEndian.Uint64(attr.Value)
+			}
+		case wgPeerAllowedIP:
+			for _, nested := range parseNetlinkAttrs(attr.Value) {
+				if cidr := parseAllowedIP(nested.Value); cidr != "" {
+					peer.AllowedIPs = append(peer.AllowedIPs, cidr)
+				}
+			}
+		}
+	}
+	for _, watched := range cfg.Wireguard.Peers {
+		if watched.PublicKey == peer.PublicKey {
+			peer.Name = watched.Name
+		}
+	}
+	return peer
+}
+
+// parseSockaddr decodes a sockaddr_in or sockaddr_in6; the family is in
+// host byte order and the port in network byte order.
+func parseSockaddr(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+	port := int(binary.BigEndian.Uint16(b[2:4]))
+	switch binary.NativeEndian.Uint16(b[0:2]) {
+	case syscall.AF_INET:
+		if len(b) >= 8 {
+			return net.JoinHostPort(net.IP(b[4:8]).String(), fmt.Sprint(port))
+		}
+	case syscall.AF_INET6:
+		if len(b) >= 24 {
+			return net.JoinHostPort(net.IP(b[8:24]).String(), fmt.Sprint(port))
+		}
+	}
+	return ""
+}
+
+func parseAllowedIP(b []byte) string {
+	var ip net.IP
+	cidr := -1
+	for _, attr := range parseNetlinkAttrs(b) {
+		switch attr.Type {
+		case wgAllowedAddr:
+			ip = net.IP(attr.Value)
+		case wgAllowedCIDR:
+			if len(attr.Value) >= 1 {
+				cidr = int(attr.Value[0])
+			}
+		}
+	}
+	if ip == nil || cidr < 0 {
+		return ""
+	}
+	ipNet := net.IPNet{IP: ip, Mask: net.CIDRMask(cidr, len(ip)*8)}
+	return ipNet.String()
+}
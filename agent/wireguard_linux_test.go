@@ -0,0 +1,228 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNetlinkAttrs(t *testing.T) {
+	skipUnlessLittleEndian(t)
+	tests := []struct {
+		name string
+		b    []byte
+		want []netlinkAttr
+	}{
+		{
+			name: "padded, nested and byte-order flagged",
+			b: []byte{
+				0x08, 0x00, 0x01, 0x00, 0x2a, 0x00, 0x00, 0x00,
+				0x05, 0x00, 0x03, 0x80, 'x', 0x00, 0x00, 0x00,
+				0x06, 0x00, 0x04, 0x40, 0x1f, 0x90, 0x00, 0x00,
+			},
+			want: []netlinkAttr{
+				{Type: 1, Value: []byte{0x2a, 0, 0, 0}},
+				{Type: 3, Value: []byte{'x'}},
+				{Type: 4, Value: []byte{0x1f, 0x90}},
+			},
+		},
+		{
+			name: "last attribute without padding",
+			b:    []byte{0x04, 0x00, 0x02, 0x00, 0x05, 0x00, 0x07, 0x00, 0x01},
+			want: []netlinkAttr{{Type: 2, Value: []byte{}}, {Type: 7, Value: []byte{0x01}}},
+		},
+		{
+			name: "truncated attribute",
+			b:    []byte{0x04, 0x00, 0x02, 0x00, 0x0c, 0x00, 0x05, 0x00, 0x01},
+			want: []netlinkAttr{{Type: 2, Value: []byte{}}},
+		},
+		{
+			name: "length below the header",
+			b:    []byte{0x02, 0x00, 0x01, 0x00, 0x08, 0x00, 0x01, 0x00},
+		},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		if got := parseNetlinkAttrs(tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseNetlinkAttrs = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Endpoints as the kernel sends them: family in host byte order, port in
+// network byte order.
+var (
+	sockaddrIn = []byte{
+		0x02, 0x00, 0xca, 0x6c, 203, 0, 113, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	}
+	sockaddrIn6 = []byte{
+		0x0a, 0x00, 0xca, 0x6c, 0, 0, 0, 0,
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01,
+		0, 0, 0, 0,
+	}
+)
+
+func TestParseSockaddr(t *testing.T) {
+	skipUnlessLittleEndian(t)
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"sockaddr_in", sockaddrIn, "203.0.113.5:51820"},
+		{"sockaddr_in6", sockaddrIn6, "[2001:db8::1]:51820"},
+		{"truncated sockaddr_in6", sockaddrIn6[:20], ""},
+		{"unknown family", []byte{0x01, 0x00, 0xca, 0x6c, 1, 2, 3, 4}, ""},
+		{"short", []byte{0x02, 0x00, 0xca}, ""},
+	}
+	for _, tt := range tests {
+		if got := parseSockaddr(tt.b); got != tt.want {
+			t.Errorf("%s: parseSockaddr = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseAllowedIP(t *testing.T) {
+	skipUnlessLittleEndian(t)
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{
+			name: "ipv4",
+			b: []byte{
+				0x06, 0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00,
+				0x08, 0x00, 0x02, 0x00, 10, 0, 1, 0,
+				0x05, 0x00, 0x03, 0x00, 24, 0x00, 0x00, 0x00,
+			},
+			want: "10.0.1.0/24",
+		},
+		{
+			name: "ipv6",
+			b: []byte{
+				0x06, 0x00, 0x01, 0x00, 0x0a, 0x00, 0x00, 0x00,
+				0x14, 0x00, 0x02, 0x00, 0xfd, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0x05, 0x00, 0x03, 0x00, 64, 0x00, 0x00, 0x00,
+			},
+			want: "fd00::/64",
+		},
+		{
+			name: "default route",
+			b: []byte{
+				0x08, 0x00, 0x02, 0x00, 0, 0, 0, 0,
+				0x05, 0x00, 0x03, 0x00, 0, 0x00, 0x00, 0x00,
+			},
+			want: "0.0.0.0/0",
+		},
+		{
+			name: "no prefix length",
+			b:    []byte{0x08, 0x00, 0x02, 0x00, 10, 0, 1, 0},
+		},
+		{
+			name: "no address",
+			b:    []byte{0x05, 0x00, 0x03, 0x00, 24, 0x00, 0x00, 0x00},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseAllowedIP(tt.b); got != tt.want {
+			t.Errorf("%s: parseAllowedIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func wgKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func wgAllowedIP(ip []byte, cidr byte) []byte {
+	return appendNetlinkAttr(appendNetlinkAttr(nil, wgAllowedAddr, ip), wgAllowedCIDR, []byte{cidr})
+}
+
+// wgList nests elements as the kernel does for peers and allowed IPs.
+func wgList(typ uint16, elements ...[]byte) []byte {
+	var list []byte
+	for i, element := range elements {
+		list = appendNetlinkAttr(list, uint16(i)|nlaFNested, element)
+	}
+	return appendNetlinkAttr(nil, typ|nlaFNested, list)
+}
+
+func wgTimespec(sec int64) []byte {
+	b := binary.NativeEndian.AppendUint64(nil, uint64(sec))
+	return binary.NativeEndian.AppendUint64(b, 0)
+}
+
+func TestParseWireguardDevice(t *testing.T) {
+	skipUnlessLittleEndian(t)
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+	cfg.Wireguard.Peers = []wireguardPeerConfig{{Name: "office", PublicKey: base64.StdEncoding.EncodeToString(wgKey(1))}}
+
+	now := time.Unix(1717300000, 0)
+	peerA := appendNetlinkAttr(nil, wgPeerPubKey, wgKey(1))
+	peerA = appendNetlinkAttr(peerA, wgPeerEndpoint, sockaddrIn)
+	peerA = appendNetlinkAttr(peerA, wgPeerKeepalive, binary.NativeEndian.AppendUint16(nil, 25))
+	peerA = appendNetlinkAttr(peerA, wgPeerHandshake, wgTimespec(now.Unix()-90))
+	peerA = appendNetlinkAttr(peerA, wgPeerRxBytes, binary.NativeEndian.AppendUint64(nil, 1500))
+	peerA = appendNetlinkAttr(peerA, wgPeerTxBytes, binary.NativeEndian.AppendUint64(nil, 2500))
+	peerA = append(peerA, wgList(wgPeerAllowedIP, wgAllowedIP([]byte{10, 0, 0, 2}, 32))...)
+
+	// The second peer's allowed IPs do not fit and continue in the next
+	// message under the same key.
+	peerB := appendNetlinkAttr(nil, wgPeerPubKey, wgKey(2))
+	peerB = append(peerB, wgList(wgPeerAllowedIP, wgAllowedIP([]byte{10, 0, 1, 0}, 24))...)
+	peerBMore := appendNetlinkAttr(nil, wgPeerPubKey, wgKey(2))
+	peerBMore = append(peerBMore, wgList(wgPeerAllowedIP, wgAllowedIP([]byte{10, 0, 2, 0}, 24))...)
+
+	// A zero handshake timestamp means no handshake yet.
+	peerC := appendNetlinkAttr(nil, wgPeerPubKey, wgKey(3))
+	peerC = appendNetlinkAttr(peerC, wgPeerEndpoint, sockaddrIn6)
+	peerC = appendNetlinkAttr(peerC, wgPeerHandshake, wgTimespec(0))
+
+	first := appendNetlinkAttr(nil, wgDeviceIfname, netlinkString("wg0"))
+	first = appendNetlinkAttr(first, wgDevicePubKey, wgKey(9))
+	first = appendNetlinkAttr(first, wgDeviceListen, binary.NativeEndian.AppendUint16(nil, 51820))
+	first = append(first, wgList(wgDevicePeers, peerA, peerB)...)
+	second := appendNetlinkAttr(nil, wgDeviceIfname, netlinkString("wg0"))
+	second = append(second, wgList(wgDevicePeers, peerBMore, peerC)...)
+
+	age := int64(90)
+	want := wireguardInterfaceInfo{
+		Name:       "wg0",
+		PublicKey:  base64.StdEncoding.EncodeToString(wgKey(9)),
+		ListenPort: 51820,
+		Peers: []wireguardPeerInfo{
+			{
+				Name:                "office",
+				PublicKey:           base64.StdEncoding.EncodeToString(wgKey(1)),
+				Endpoint:            "203.0.113.5:51820",
+				AllowedIPs:          []string{"10.0.0.2/32"},
+				LatestHandshake:     "2024-06-02T03:45:10Z",
+				HandshakeAgeSeconds: &age,
+				KeepaliveSeconds:    25,
+				RxBytes:             1500,
+				TxBytes:             2500,
+			},
+			{
+				PublicKey:  base64.StdEncoding.EncodeToString(wgKey(2)),
+				AllowedIPs: []string{"10.0.1.0/24", "10.0.2.0/24"},
+			},
+			{
+				PublicKey:  base64.StdEncoding.EncodeToString(wgKey(3)),
+				Endpoint:   "[2001:db8::1]:51820",
+				AllowedIPs: []string{},
+			},
+		},
+	}
+	if got := parseWireguardDevice("wg0", [][]byte{first, second}, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseWireguardDevice\n got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	wgOfficeKey = "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	wgLaptopKey = "AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="
+)
+
+func TestWireguardConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config wireguardConfig
+		ok     bool
+	}{
+		{"defaults", defaultConfig().Wireguard, true},
+		{"watched peer", wireguardConfig{Enabled: true, HandshakeMaxAge: duration{time.Minute}, Peers: []wireguardPeerConfig{{PublicKey: wgOfficeKey}}}, true},
+		{"zero handshake_max_age", wireguardConfig{Enabled: true}, false},
+		{"negative handshake_max_age", wireguardConfig{Enabled: true, HandshakeMaxAge: duration{-time.Minute}}, false},
+		{"disabled", wireguardConfig{}, true},
+		{"short public_key", wireguardConfig{Enabled: true, HandshakeMaxAge: duration{time.Minute}, Peers: []wireguardPeerConfig{{PublicKey: "AQEB"}}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: validate() = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestEvaluateWireguardHealth(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+	cfg.Wireguard.Peers = []wireguardPeerConfig{
+		{Name: "office", PublicKey: wgOfficeKey},
+		{PublicKey: wgLaptopKey, MaxHandshakeAge: duration{time.Hour}},
+	}
+
+	age := func(seconds int64) *int64 { return &seconds }
+	tests := []struct {
+		name       string
+		interfaces []wireguardInterfaceInfo
+		readErr    error
+		status     string
+		reasons    []string
+	}{
+		{
+			name: "fresh handshakes",
+			interfaces: []wireguardInterfaceInfo{{Name: "wg0", Peers: []wireguardPeerInfo{
+				{PublicKey: wgOfficeKey, HandshakeAgeSeconds: age(100)},
+				{PublicKey: wgLaptopKey, HandshakeAgeSeconds: age(1800)},
+			}}},
+			status:  "ok",
+			reasons: []string{},
+		},
+		{
+			name: "stale, never and missing",
+			interfaces: []wireguardInterfaceInfo{{Name: "wg0", Peers: []wireguardPeerInfo{
+				{PublicKey: wgOfficeKey, HandshakeAgeSeconds: age(600)},
+			}}},
+			status: "critical",
+			reasons: []string{
+				"wireguard peer 'office' last handshake 10m ago",
+				"wireguard peer '" + wgLaptopKey + "' not found",
+			},
+		},
+		{
+			name: "no handshake yet",
+			interfaces: []wireguardInterfaceInfo{{Name: "wg0", Peers: []wireguardPeerInfo{
+				{PublicKey: wgOfficeKey},
+				{PublicKey: wgLaptopKey, HandshakeAgeSeconds: age(10)},
+			}}},
+			status:  "critical",
+			reasons: []string{"wireguard peer 'office' has never completed a handshake"},
+		},
+		{
+			name:    "read error is reported once",
+			readErr: errors.New("operation not permitted"),
+			status:  "warning",
+			reasons: []string{"wireguard peers unknown: operation not permitted"},
+		},
+	}
+	for _, tt := range tests {
+		health := healthInfo{Status: "ok", Reasons: []string{}}
+		evaluateWireguardHealth(&health, tt.interfaces, tt.readErr)
+		if health.Status != tt.status || !reflect.DeepEqual(health.Reasons, tt.reasons) {
+			t.Errorf("%s: health = %s %q, want %s %q", tt.name, health.Status, health.Reasons, tt.status, tt.reasons)
+		}
+	}
+}